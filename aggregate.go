@@ -0,0 +1,267 @@
+package celiter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Reduce folds the remaining elements of v into a single value, starting
+// from init and calling f with the accumulated value and each element. This
+// is useful to compute aggregates, like sums, before exposing them to CEL.
+//
+// If checking for or getting the next element fails, the value accumulated
+// so far is returned along with the error.
+func Reduce[T, A any](v *Value[T], init A, f func(A, T) A) (A, error) {
+	acc := init
+	for {
+		ok, err := v.checkNext()
+		if err != nil {
+			return acc, &Err{Op: "checking for next element", Err: err}
+		}
+		if !ok {
+			return acc, nil
+		}
+
+		next, err := v.advance()
+		if err != nil {
+			return acc, &Err{Op: "getting next element", Err: err}
+		}
+
+		acc = f(acc, next)
+	}
+}
+
+// Count returns the number of remaining elements of v which satisfy pred,
+// draining v once. Elements are converted before being passed to pred, so
+// it can be shared with functions working on CEL values.
+//
+// If checking for or getting the next element fails, the count so far is
+// returned along with the error.
+func Count[T any](v *Value[T], pred func(ref.Val) bool) (int, error) {
+	return Reduce(v, 0, func(n int, next T) int {
+		if pred(v.convert(next)) {
+			n++
+		}
+		return n
+	})
+}
+
+// ForEach calls fn with each remaining element of v, until v is exhausted
+// or fn returns false, so host code can consume an iterable returned by an
+// expression without writing the HasNext and Next loop.
+//
+// If checking for or getting the next element fails, iteration stops and
+// the error is returned, see AsError.
+func ForEach[T any](v *Value[T], fn func(ref.Val) bool) error {
+	for {
+		hasNext := v.HasNext()
+		if err, ok := AsError(hasNext); ok {
+			return err
+		}
+		if hasNext != types.True {
+			return nil
+		}
+
+		next := v.Next()
+		if err, ok := AsError(next); ok {
+			return err
+		}
+		if !fn(next) {
+			return nil
+		}
+	}
+}
+
+// MinBy drains v and returns its smallest element according to less, and
+// whether there is one. If several elements are equally small, the first of
+// them is returned. If v is empty, nil is returned. It never returns for
+// infinite sources.
+//
+// If checking for or getting the next element fails, nil and false are
+// returned along with the error.
+func MinBy[T any](v *Value[T], less func(T, T) bool) (ref.Val, bool, error) {
+	return extremum(v, less)
+}
+
+// MaxBy drains v and returns its largest element according to less, and
+// whether there is one. If several elements are equally large, the first of
+// them is returned. If v is empty, nil is returned. It never returns for
+// infinite sources.
+//
+// If checking for or getting the next element fails, nil and false are
+// returned along with the error.
+func MaxBy[T any](v *Value[T], less func(T, T) bool) (ref.Val, bool, error) {
+	return extremum(v, func(a, b T) bool {
+		return less(b, a)
+	})
+}
+
+// extremum returns the first element of v which no other element is before
+// according to before, see MinBy and MaxBy.
+func extremum[T any](v *Value[T], before func(T, T) bool) (ref.Val, bool, error) {
+	var (
+		zero  T
+		found bool
+	)
+
+	best, err := Reduce(v, zero, func(best, next T) T {
+		if !found || before(next, best) {
+			found = true
+			return next
+		}
+		return best
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	return v.convert(best), true, nil
+}
+
+// GroupBy drains v and groups its remaining elements by the key returned by
+// keyFn, keeping the elements of each group in their original order. This is
+// useful to aggregate elements before exposing them to CEL.
+//
+// Every element is kept in memory, so GroupBy never returns for infinite
+// sources, unless a limit is set on v with WithSizeLimit, in which case an
+// error is returned once it is exceeded.
+func GroupBy[T any, K comparable](v *Value[T], keyFn func(T) K) (map[K][]T, error) {
+	elems, err := v.drain()
+	if err != nil {
+		return nil, fmt.Errorf("unable to group %s: %w", v.Type().TypeName(), err)
+	}
+
+	groups := make(map[K][]T)
+	for _, elem := range elems {
+		key := keyFn(elem)
+		groups[key] = append(groups[key], elem)
+	}
+
+	return groups, nil
+}
+
+// First returns the next element of v, and whether there is one. If v is
+// empty, nil is returned.
+//
+// If checking for or getting the next element fails, the CEL error value is
+// returned along with false.
+func First[T any](v *Value[T]) (ref.Val, bool) {
+	hasNext := v.HasNext()
+	if types.IsError(hasNext) {
+		return hasNext, false
+	}
+	if hasNext != types.True {
+		return nil, false
+	}
+
+	next := v.Next()
+	if types.IsError(next) {
+		return next, false
+	}
+
+	return next, true
+}
+
+// Last drains v and returns its final element, and whether there is one. If
+// v is empty, nil is returned. It never returns for infinite sources.
+//
+// If checking for or getting the next element fails, the CEL error value is
+// returned along with false.
+func Last[T any](v *Value[T]) (ref.Val, bool) {
+	var last ref.Val
+	for {
+		hasNext := v.HasNext()
+		if types.IsError(hasNext) {
+			return hasNext, false
+		}
+		if hasNext != types.True {
+			return last, last != nil
+		}
+
+		next := v.Next()
+		if types.IsError(next) {
+			return next, false
+		}
+		last = next
+	}
+}
+
+// Nth returns the element of v at index n, like Get, but returns a Go error
+// instead of a CEL error value, like when n is out of bounds or already
+// passed.
+func Nth[T any](v *Value[T], n int) (ref.Val, error) {
+	val := v.Get(types.Int(n))
+	if err, ok := val.(*types.Err); ok {
+		return nil, err
+	}
+
+	return val, nil
+}
+
+// EqualSeq drains a and b, and reports whether they have the same number of
+// elements and each pair of elements is equal, like Equal, but returns a Go
+// error instead of a CEL error value if iterating over either one fails.
+// This is useful in tests to compare iterables by their content.
+func EqualSeq[T any](a, b *Value[T]) (bool, error) {
+	eq := a.Equal(b)
+	if err, ok := AsError(eq); ok {
+		return false, err
+	}
+
+	return eq == types.True, nil
+}
+
+// ContainsValue reports whether v contains target, like Contains, but
+// compares elements directly with ==, without converting them to CEL values.
+// This is faster, and avoids surprises from conversion, like elements which
+// convert to equal CEL values but aren't equal in Go.
+//
+// ContainsValue advances v until a match is found, like Contains, and honors
+// WithCache and WithSizeLimit the same way. The comparator set with
+// WithContainsComparator isn't used.
+func ContainsValue[T comparable](v *Value[T], target T) (bool, error) {
+	defer v.lock()()
+
+	if v.at != nil {
+		for i := range v.length() {
+			if v.sizeLimit > 0 && i >= v.sizeLimit {
+				return false, fmt.Errorf("unable to check if iterable contains value: size exceeded maximum of %d", v.sizeLimit)
+			}
+			if v.at(i) == target {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if v.cache && slices.Contains(v.cached, target) {
+		return true, nil
+	}
+
+	for {
+		ok, err := v.checkNext()
+		if err != nil {
+			return false, &Err{Op: "checking for next element", Err: err}
+		}
+		if !ok {
+			return false, nil
+		}
+		if v.sizeLimit > 0 && v.index+1 >= v.sizeLimit {
+			return false, fmt.Errorf("unable to check if iterable contains value: size exceeded maximum of %d", v.sizeLimit)
+		}
+
+		next, err := v.advance()
+		if err != nil {
+			return false, &Err{Op: "getting next element", Err: err}
+		}
+		if next == target {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package celiter_test
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+func TestReduce(t *testing.T) {
+	sum := func(acc, v int) int {
+		return acc + v
+	}
+
+	t.Run("sum", func(t *testing.T) {
+		total, err := celiter.Reduce(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4}), nil), 0, sum)
+		must.NoError(t, err)
+		must.Eq(t, total, 10)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		total, err := celiter.Reduce(celiter.FromSeq(slices.Values([]int{}), nil), 5, sum)
+		must.NoError(t, err)
+		must.Eq(t, total, 5)
+	})
+
+	t.Run("has next error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		var (
+			values = []int{1, 2, 3, 4}
+			index  = 0
+		)
+
+		val := celiter.New(
+			func() (bool, error) {
+				if index == 2 {
+					return false, errSentinel
+				}
+				return index < len(values), nil
+			},
+			func() (int, error) {
+				val := values[index]
+				index++
+				return val, nil
+			},
+			nil,
+		)
+
+		total, err := celiter.Reduce(val, 0, sum)
+		must.ErrorIs(t, err, errSentinel)
+		must.Eq(t, total, 3)
+	})
+}
+
+func TestCount(t *testing.T) {
+	even := func(v ref.Val) bool {
+		return v.(types.Int)%2 == 0
+	}
+
+	t.Run("even", func(t *testing.T) {
+		n, err := celiter.Count(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4, 5, 6}), nil), even)
+		must.NoError(t, err)
+		must.Eq(t, n, 3)
+	})
+
+	t.Run("has next error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		var (
+			values = []int{1, 2, 3, 4, 5, 6}
+			index  = 0
+		)
+
+		val := celiter.New(
+			func() (bool, error) {
+				if index == 4 {
+					return false, errSentinel
+				}
+				return index < len(values), nil
+			},
+			func() (int, error) {
+				val := values[index]
+				index++
+				return val, nil
+			},
+			nil,
+		)
+
+		n, err := celiter.Count(val, even)
+		must.ErrorIs(t, err, errSentinel)
+		must.Eq(t, n, 2)
+	})
+}
+
+func TestForEach(t *testing.T) {
+	t.Run("all elements", func(t *testing.T) {
+		var got []ref.Val
+		err := celiter.ForEach(celiter.FromSlice([]int{1, 2, 3}, nil), func(v ref.Val) bool {
+			got = append(got, v)
+			return true
+		})
+		must.NoError(t, err)
+		must.Eq(t, got, []ref.Val{types.Int(1), types.Int(2), types.Int(3)})
+	})
+
+	t.Run("early stop", func(t *testing.T) {
+		val := celiter.FromSeq(fibonacciSeq, nil)
+
+		var got []ref.Val
+		err := celiter.ForEach(val, func(v ref.Val) bool {
+			got = append(got, v)
+			return len(got) < 3
+		})
+		must.NoError(t, err)
+		must.Eq(t, got, []ref.Val{types.Int(0), types.Int(1), types.Int(1)})
+		must.Eq(t, val.Index(), 2)
+	})
+
+	t.Run("next error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		var index int
+		val := celiter.New(
+			func() (bool, error) {
+				return true, nil
+			},
+			func() (int, error) {
+				if index == 2 {
+					return 0, errSentinel
+				}
+				index++
+				return index, nil
+			},
+			nil,
+		)
+
+		var got []ref.Val
+		err := celiter.ForEach(val, func(v ref.Val) bool {
+			got = append(got, v)
+			return true
+		})
+		must.ErrorIs(t, err, errSentinel)
+		must.Eq(t, got, []ref.Val{types.Int(1), types.Int(2)})
+	})
+}
+
+func TestMinMaxBy(t *testing.T) {
+	less := func(a, b int) bool {
+		return a < b
+	}
+
+	t.Run("min", func(t *testing.T) {
+		minVal, ok, err := celiter.MinBy(celiter.FromSlice([]int{3, 1, 4, 1, 5}, nil), less)
+		must.NoError(t, err)
+		must.True(t, ok)
+		must.Eq[ref.Val](t, minVal, types.Int(1))
+	})
+
+	t.Run("max", func(t *testing.T) {
+		maxVal, ok, err := celiter.MaxBy(celiter.FromSlice([]int{3, 1, 4, 1, 5}, nil), less)
+		must.NoError(t, err)
+		must.True(t, ok)
+		must.Eq[ref.Val](t, maxVal, types.Int(5))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		minVal, ok, err := celiter.MinBy(celiter.FromSlice([]int{}, nil), less)
+		must.NoError(t, err)
+		must.False(t, ok)
+		must.Nil(t, minVal)
+	})
+
+	t.Run("has next error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		val := celiter.New(
+			func() (bool, error) {
+				return false, errSentinel
+			},
+			func() (int, error) {
+				return 0, nil
+			},
+			nil,
+		)
+
+		maxVal, ok, err := celiter.MaxBy(val, less)
+		must.ErrorIs(t, err, errSentinel)
+		must.False(t, ok)
+		must.Nil(t, maxVal)
+	})
+}
+
+func TestGroupBy(t *testing.T) {
+	firstLetter := func(s string) byte {
+		return s[0]
+	}
+
+	t.Run("first letter", func(t *testing.T) {
+		groups, err := celiter.GroupBy(celiter.FromSlice([]string{"apple", "avocado", "banana"}, nil), firstLetter)
+		must.NoError(t, err)
+		must.Eq(t, groups, map[byte][]string{
+			'a': {"apple", "avocado"},
+			'b': {"banana"},
+		})
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		_, err := celiter.GroupBy(celiter.FromSeq(fibonacciSeq, nil, celiter.WithSizeLimit(10)), func(n int) int {
+			return n % 2
+		})
+		must.ErrorContains(t, err, "size exceeded maximum of 10")
+	})
+}
+
+func TestFirstLast(t *testing.T) {
+	values := []string{"test", "example", "sample"}
+
+	t.Run("first", func(t *testing.T) {
+		first, ok := celiter.First(celiter.FromSeq(slices.Values(values), nil))
+		must.True(t, ok)
+		must.Eq[ref.Val](t, types.String("test"), first)
+	})
+
+	t.Run("last", func(t *testing.T) {
+		last, ok := celiter.Last(celiter.FromSeq(slices.Values(values), nil))
+		must.True(t, ok)
+		must.Eq[ref.Val](t, types.String("sample"), last)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		first, ok := celiter.First(celiter.FromSeq(slices.Values([]string{}), nil))
+		must.False(t, ok)
+		must.Nil(t, first)
+
+		last, ok := celiter.Last(celiter.FromSeq(slices.Values([]string{}), nil))
+		must.False(t, ok)
+		must.Nil(t, last)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		val := celiter.New(
+			func() (bool, error) {
+				return false, errors.New("sentinel")
+			},
+			func() (string, error) {
+				return "", nil
+			},
+			nil,
+		)
+
+		last, ok := celiter.Last(val)
+		must.False(t, ok)
+		must.True(t, types.IsError(last))
+	})
+}
+
+func TestNth(t *testing.T) {
+	values := []string{"test", "example", "sample"}
+
+	t.Run("in range", func(t *testing.T) {
+		val, err := celiter.Nth(celiter.FromSeq(slices.Values(values), nil), 2)
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, types.String("sample"), val)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		val, err := celiter.Nth(celiter.FromSeq(slices.Values(values), nil), 3)
+		must.ErrorContains(t, err, "index out of bounds")
+		must.Nil(t, val)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		_, err := celiter.Nth(celiter.FromSeq(slices.Values(values), nil), -1)
+		must.ErrorContains(t, err, "index cannot be negative")
+	})
+}
+
+func TestEqualSeq(t *testing.T) {
+	t.Run("equal", func(t *testing.T) {
+		eq, err := celiter.EqualSeq(
+			celiter.FromSeq(slices.Values([]string{"test", "example"}), nil),
+			celiter.FromSlice([]string{"test", "example"}, nil),
+		)
+		must.NoError(t, err)
+		must.True(t, eq)
+	})
+
+	t.Run("different", func(t *testing.T) {
+		eq, err := celiter.EqualSeq(
+			celiter.FromSeq(slices.Values([]string{"test", "example"}), nil),
+			celiter.FromSeq(slices.Values([]string{"test", "sample"}), nil),
+		)
+		must.NoError(t, err)
+		must.False(t, eq)
+	})
+
+	t.Run("different length", func(t *testing.T) {
+		eq, err := celiter.EqualSeq(
+			celiter.FromSeq(slices.Values([]string{"test", "example"}), nil),
+			celiter.FromSeq(slices.Values([]string{"test"}), nil),
+		)
+		must.NoError(t, err)
+		must.False(t, eq)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		eq, err := celiter.EqualSeq(celiter.Empty[string](), celiter.FromSeq(slices.Values([]string{}), nil))
+		must.NoError(t, err)
+		must.True(t, eq)
+	})
+
+	t.Run("has next error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		eq, err := celiter.EqualSeq(
+			celiter.FromSeq(slices.Values([]string{"test"}), nil),
+			celiter.New[string](func() (bool, error) {
+				return false, errSentinel
+			}, nil, nil),
+		)
+		must.ErrorIs(t, err, errSentinel)
+		must.False(t, eq)
+	})
+}
+
+func TestContainsValue(t *testing.T) {
+	values := []string{"test", "example", "sample"}
+
+	tests := []struct {
+		name   string
+		val    func() *celiter.Value[string]
+		target string
+		want   bool
+	}{
+		{
+			name:   "seq found",
+			val:    func() *celiter.Value[string] { return celiter.FromSeq(slices.Values(values), nil) },
+			target: "example",
+			want:   true,
+		},
+		{
+			name:   "seq missing",
+			val:    func() *celiter.Value[string] { return celiter.FromSeq(slices.Values(values), nil) },
+			target: "missing",
+			want:   false,
+		},
+		{
+			name:   "slice found",
+			val:    func() *celiter.Value[string] { return celiter.FromSlice(values, nil) },
+			target: "sample",
+			want:   true,
+		},
+		{
+			name:   "slice missing",
+			val:    func() *celiter.Value[string] { return celiter.FromSlice(values, nil) },
+			target: "missing",
+			want:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := celiter.ContainsValue(test.val(), test.target)
+			must.NoError(t, err)
+			must.Eq(t, found, test.want)
+			must.Eq[ref.Val](t, test.val().Contains(types.String(test.target)), types.Bool(test.want))
+		})
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil, celiter.WithCache())
+
+		found, err := celiter.ContainsValue(val, "example")
+		must.NoError(t, err)
+		must.True(t, found)
+
+		found, err = celiter.ContainsValue(val, "test")
+		must.NoError(t, err)
+		must.True(t, found)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		val := celiter.Repeat("test", -1, nil, celiter.WithSizeLimit(10))
+
+		_, err := celiter.ContainsValue(val, "missing")
+		must.ErrorContains(t, err, "size exceeded maximum of 10")
+	})
+}
+
+func BenchmarkContainsValue(b *testing.B) {
+	values := make([]string, 1000)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	target := values[len(values)-1]
+
+	b.Run("contains", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			celiter.FromSeq(slices.Values(values), nil).Contains(types.String(target))
+		}
+	})
+
+	b.Run("contains value", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			_, _ = celiter.ContainsValue(celiter.FromSeq(slices.Values(values), nil), target)
+		}
+	})
+}
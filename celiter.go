@@ -1,9 +1,14 @@
 package celiter
 
 import (
+	"context"
 	"fmt"
 	"iter"
+	"math"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
@@ -11,19 +16,24 @@ import (
 )
 
 // Ensure the Value type implements the ref.Val interface,
-// the traits.Iterator interface, and the traits.Iterable interface.
+// the traits.Iterator interface, the traits.Iterable interface,
+// the traits.Comparer interface, and the SizeHinter and Peekable interfaces.
 var (
 	_ ref.Val         = (*Value[any])(nil)
 	_ traits.Iterator = (*Value[any])(nil)
 	_ traits.Iterable = (*Value[any])(nil)
+	_ traits.Comparer = (*Value[any])(nil)
+	_ fmt.Stringer    = (*Value[any])(nil)
+	_ SizeHinter      = (*Value[any])(nil)
+	_ Peekable        = (*Value[any])(nil)
 )
 
 // Type is the type of the iterable value. Use this when defining custom
 // CEL functions that handle (or return) iterable values.
 //
-// These values are iterable, indexable, and have a size.
+// These values are iterable, indexable, comparable, and have a size.
 var Type = types.DynType.WithTraits(
-	traits.IterableType | traits.IteratorType | traits.IndexerType | traits.SizerType | traits.ContainerType,
+	traits.IterableType | traits.IteratorType | traits.IndexerType | traits.SizerType | traits.ContainerType | traits.ComparerType,
 )
 
 // HasNext is a function that checks if there is a next element in the iterable.
@@ -36,167 +46,1558 @@ type Next[T any] func() (T, error)
 // which can be used in CEL expressions.
 type Convert[T any] func(T) ref.Val
 
+// ConvertE is a function that converts an element of type T to a ref.Val
+// type, like Convert, but which can fail. See NewE.
+type ConvertE[T any] func(T) (ref.Val, error)
+
 // New created a new iterable Value instance for use in CEL expressions.
-func New[T any](hasNext HasNext, next Next[T], convert Convert[T]) *Value[T] {
+func New[T any](hasNext HasNext, next Next[T], convert Convert[T], opts ...Option) *Value[T] {
+	v := &Value[T]{}
+	v.init(hasNext, next, convert, opts...)
+	return v
+}
+
+// init sets up v like New, replacing any previous state, except for the
+// capacity of the cache, so pooled values can reuse it (see Pool).
+func (v *Value[T]) init(hasNext HasNext, next Next[T], convert Convert[T], opts ...Option) {
+	o := applyOptions(opts...)
+
 	if hasNext == nil {
 		hasNext = func() (bool, error) {
 			return false, nil
 		}
 	}
 
-	if next == nil {
-		next = func() (T, error) {
-			var zero T
-			return zero, fmt.Errorf("no next element")
+	if next == nil {
+		next = func() (T, error) {
+			var zero T
+			return zero, fmt.Errorf("no next element")
+		}
+	}
+
+	if convert == nil {
+		convert = func(t T) ref.Val {
+			return o.adapter.NativeToValue(t)
+		}
+	}
+
+	if o.intOverflow {
+		convert = checkIntOverflow(convert)
+	}
+
+	if o.prefetch > 0 {
+		hasNext, next, o.restart, o.close = prefetch(o.prefetch, o.ctx, hasNext, next, o.restart, o.close)
+	}
+
+	var mu *sync.Mutex
+	if o.mutex {
+		mu = &sync.Mutex{}
+	}
+
+	*v = Value[T]{
+		hasNext:       hasNext,
+		next:          next,
+		convert:       convert,
+		restart:       o.restart,
+		close:         o.close,
+		ctx:           o.ctx,
+		cache:         o.cache || o.negativeIndex,
+		negativeIndex: o.negativeIndex,
+		sizeLimit:     o.sizeLimit,
+		adapter:       o.adapter,
+		mu:            mu,
+		recover:       !o.noRecover,
+		containsEqual: o.containsEqual,
+		onNext:        o.onNext,
+		onError:       o.onError,
+		rateLimit:     o.rateLimit,
+		resetOnIter:   o.resetOnIter,
+		logger:        o.logger,
+		cached:        v.cached[:0],
+		index:         -1,
+	}
+}
+
+// checkIntOverflow wraps convert so an unsigned integer element which doesn't
+// fit in a CEL int is converted to an error, see WithIntOverflowCheck.
+func checkIntOverflow[T any](convert Convert[T]) Convert[T] {
+	return func(t T) ref.Val {
+		val := convert(t)
+		if _, ok := val.(types.Int); !ok {
+			return val
+		}
+		switch rv := reflect.ValueOf(t); rv.Kind() {
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			if rv.Uint() > math.MaxInt64 {
+				return types.NewErr("unable to convert %v to int: integer overflow", rv.Uint())
+			}
+		}
+		return val
+	}
+}
+
+// NewE creates a new iterable Value instance like New, but with a convert
+// function which can fail. A conversion error is returned from Next as a CEL
+// error wrapping it, like errors from next, so it surfaces when evaluating
+// the expression.
+//
+// If convert is nil, the elements are converted like with New.
+func NewE[T any](hasNext HasNext, next Next[T], convert ConvertE[T], opts ...Option) *Value[T] {
+	if convert == nil {
+		return New(hasNext, next, nil, opts...)
+	}
+
+	return New(hasNext, next, func(t T) ref.Val {
+		val, err := convert(t)
+		if err != nil {
+			return types.WrapErr(fmt.Errorf("error converting next element: %w", err))
+		}
+		return val
+	}, opts...)
+}
+
+// Value represents an iterable value in CEL expressions.
+type Value[T any] struct {
+	index         int
+	cur           T
+	hasNext       HasNext
+	next          Next[T]
+	convert       Convert[T]
+	restart       func() error
+	close         func() error
+	ctx           context.Context
+	sizeLimit     int
+	cache         bool
+	cached        []T
+	negativeIndex bool
+	peek          T
+	peeked        bool
+	pending       []T
+	adapter       types.Adapter
+	mu            *sync.Mutex
+	recover       bool
+	containsEqual func(cur, target ref.Val) bool
+	clone         func() *Value[T]
+	sizeHint      func() (int, bool)
+	length        func() int
+	at            func(int) T
+	lookup        func(key ref.Val, convert Convert[T]) ref.Val
+	onNext        func(index int, val ref.Val)
+	onError       func(error)
+	rateLimit     time.Duration
+	lastFetch     time.Time
+	paced         bool
+	resetOnIter   bool
+	drained       bool
+	logger        func(format string, args ...any)
+}
+
+// SizeHinter is implemented by iterable values which may know how many
+// elements they have left without iterating over them.
+type SizeHinter interface {
+	// SizeHint returns the number of remaining elements, and whether it is
+	// known. If it isn't, zero and false are returned.
+	SizeHint() (int, bool)
+}
+
+// Peekable is implemented by iterators with one element of lookahead, so
+// code like parsers can work with any iterable value, whatever its element
+// type, and decide what to do based on the next element before consuming it.
+//
+// Peek returns the next element and whether there is one, without advancing
+// the iterator, so calling it again, or calling Next, returns the same
+// element. Only the next element can be inspected.
+type Peekable interface {
+	traits.Iterator
+
+	// Peek returns the next element without advancing the iterator, and
+	// whether there is one. If there isn't, or checking for it fails, the
+	// CEL error value or false is returned along with false.
+	Peek() (ref.Val, bool)
+}
+
+// ConvertToNative converts the current iterable value to a native Go type.
+//
+// If typ is a slice type, like []string, and neither the elements nor the
+// current element are of that type, the remaining elements are drained into a
+// new slice instead. Elements which can't be assigned to the slice's element
+// type are converted with their CEL value's ConvertToNative, and an error is
+// returned if that fails too.
+func (v *Value[T]) ConvertToNative(typ reflect.Type) (any, error) {
+	nativeValue := v.Value()
+	nativeType := reflect.TypeOf(nativeValue)
+
+	if typ.Kind() == reflect.Slice && !reflect.TypeFor[T]().AssignableTo(typ) &&
+		(nativeType == nil || !nativeType.AssignableTo(typ)) {
+		return v.nativeSlice(typ)
+	}
+
+	if nativeType == nil {
+		return nil, fmt.Errorf("unable to convert %s to native type %s: no current element", v.Type().TypeName(), typ.Name())
+	}
+	if nativeType.AssignableTo(typ) {
+		return nativeValue, nil
+	}
+	return nil, fmt.Errorf("unable to convert %s to native type %s", v.Type().TypeName(), typ.Name())
+}
+
+// nativeSlice drains the remaining elements of the iterable into a new slice
+// of the given type, see ConvertToNative.
+func (v *Value[T]) nativeSlice(typ reflect.Type) (any, error) {
+	defer v.lock()()
+
+	elems, err := v.drain()
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert %s to native type %s: %w", v.Type().TypeName(), typ, err)
+	}
+
+	elemType := typ.Elem()
+	assignable := reflect.TypeFor[T]().AssignableTo(elemType)
+
+	slice := reflect.MakeSlice(typ, len(elems), len(elems))
+	for i, elem := range elems {
+		if assignable {
+			slice.Index(i).Set(reflect.ValueOf(&elem).Elem())
+			continue
+		}
+
+		native, err := v.convert(elem).ConvertToNative(elemType)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert %s to native type %s: element %d: %w", v.Type().TypeName(), typ, i, err)
+		}
+		nativeValue := reflect.ValueOf(native)
+		if !nativeValue.IsValid() || !nativeValue.Type().AssignableTo(elemType) {
+			return nil, fmt.Errorf("unable to convert %s to native type %s: element %d: got %T", v.Type().TypeName(), typ, i, native)
+		}
+		slice.Index(i).Set(nativeValue)
+	}
+
+	return slice.Interface(), nil
+}
+
+// ConvertToType converts the current iterable value to a ref.Val type.
+//
+// Converting to a CEL list drains the remaining elements of the iterable
+// into a new list value, while converting to a CEL string renders a preview
+// of the next few elements (see String).
+func (ci *Value[T]) ConvertToType(typ ref.Type) ref.Val {
+	switch typ {
+	case Type:
+		return ci
+	case types.TypeType:
+		return Type
+	case types.StringType:
+		return types.String(ci.String())
+	case types.ListType:
+		return ci.ToList()
+	}
+
+	return types.NewErr(fmt.Sprintf("unable to convert %s to type %s", ci.Type().TypeName(), typ.TypeName()))
+}
+
+// Equal checks if the current iterable value is equal to another ref.Val type.
+//
+// Another iterable, like a celiter iterable or a CEL list, is equal when both
+// contain the same number of elements and each pair of elements is equal.
+// Maps are never equal to iterables. Comparing elements consumes both
+// iterables, so they should not be reused afterward without a Reset.
+//
+// If the other value is a list and the number of remaining elements is known
+// (see SizeHint), lists of a different size are unequal without iterating.
+//
+// Only comparisons with the iterable on the left use this method, like
+// "values() == ['a', 'b']". CEL lists only compare equal to other lists, so
+// "['a', 'b'] == values()" is always false. Convert the iterable with ToList
+// first to compare it on either side.
+func (ci *Value[T]) Equal(other ref.Val) ref.Val {
+	if otherValue, ok := other.(*Value[T]); ok && ci == otherValue {
+		return types.True
+	}
+
+	if _, ok := other.(traits.Mapper); ok {
+		return types.False
+	}
+
+	otherIterable, ok := other.(traits.Iterable)
+	if !ok {
+		return types.False
+	}
+
+	if lister, ok := other.(traits.Lister); ok {
+		if size, ok := ci.SizeHint(); ok && lister.Size() != types.Int(size) {
+			return types.False
+		}
+	}
+
+	otherIter := otherIterable.Iterator()
+
+	for {
+		hasNext := ci.HasNext()
+		if types.IsError(hasNext) {
+			return hasNext
+		}
+		otherHasNext := otherIter.HasNext()
+		if types.IsError(otherHasNext) {
+			return otherHasNext
+		}
+		if hasNext != otherHasNext {
+			return types.False
+		}
+		if hasNext != types.True {
+			return types.True
+		}
+
+		next := ci.Next()
+		if types.IsError(next) {
+			return next
+		}
+		otherNext := otherIter.Next()
+		if types.IsError(otherNext) {
+			return otherNext
+		}
+
+		eq := types.Equal(next, otherNext)
+		if eq != types.True {
+			if types.IsError(eq) {
+				return eq
+			}
+			return types.False
+		}
+	}
+}
+
+// Compare lexicographically compares the iterable value with another celiter
+// iterable or a CEL list, returning -1, 0, or 1 as a CEL int.
+//
+// Elements are compared pairwise until they differ, and if one iterable is a
+// prefix of the other, the shorter one is less. An error is returned if a
+// pair of elements can't be compared. Like Equal, this consumes both
+// iterables, except that an iterable is equal to itself without iterating.
+func (ci *Value[T]) Compare(other ref.Val) ref.Val {
+	if otherValue, ok := other.(*Value[T]); ok && ci == otherValue {
+		return types.IntZero
+	}
+
+	if other.Type() != Type && other.Type() != types.ListType {
+		return types.NoSuchOverloadErr()
+	}
+
+	otherIterable, ok := other.(traits.Iterable)
+	if !ok {
+		return types.NoSuchOverloadErr()
+	}
+	otherIter := otherIterable.Iterator()
+
+	for {
+		hasNext := ci.HasNext()
+		if types.IsError(hasNext) {
+			return hasNext
+		}
+		otherHasNext := otherIter.HasNext()
+		if types.IsError(otherHasNext) {
+			return otherHasNext
+		}
+		switch {
+		case hasNext != types.True && otherHasNext != types.True:
+			return types.IntZero
+		case hasNext != types.True:
+			return types.IntNegOne
+		case otherHasNext != types.True:
+			return types.IntOne
+		}
+
+		next := ci.Next()
+		if types.IsError(next) {
+			return next
+		}
+		otherNext := otherIter.Next()
+		if types.IsError(otherNext) {
+			return otherNext
+		}
+
+		comparer, ok := next.(traits.Comparer)
+		if !ok {
+			return types.NewErr("unable to compare %s with %s", next.Type().TypeName(), otherNext.Type().TypeName())
+		}
+		cmp := comparer.Compare(otherNext)
+		if cmp != types.IntZero {
+			return cmp
+		}
+	}
+}
+
+// Type returns the type of the iterable value.
+func (ci *Value[T]) Type() ref.Type {
+	return Type
+}
+
+// previewLimit is the maximum number of elements rendered by String.
+const previewLimit = 10
+
+// String renders a preview of the remaining elements of the iterable, like
+// "celiter[test, example, sample]", which is useful for debugging and logging.
+//
+// At most 10 elements are rendered, followed by "..." if there are more, so
+// infinite iterables can be printed. Rendering doesn't consume the elements:
+// values with random access are read directly, and elements read from other
+// sources are buffered, so they are yielded again by the following calls to
+// Next.
+func (ci *Value[T]) String() string {
+	defer ci.lock()()
+
+	elems, err := ci.preview(previewLimit + 1)
+
+	var sb strings.Builder
+	sb.WriteString("celiter[")
+	for i, elem := range elems {
+		writePreviewSep(&sb, i)
+		if i == previewLimit {
+			sb.WriteString("...")
+			break
+		}
+		fmt.Fprintf(&sb, "%v", ci.convert(elem))
+	}
+	if err != nil {
+		writePreviewSep(&sb, len(elems))
+		fmt.Fprintf(&sb, "%v", types.WrapErr(err))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// preview returns up to n of the remaining elements of ci without consuming
+// them, along with any error reading them, see String.
+func (ci *Value[T]) preview(n int) ([]T, error) {
+	var elems []T
+	if ci.at != nil {
+		for i := ci.index + 1; i < ci.length() && len(elems) < n; i++ {
+			elems = append(elems, ci.at(i))
+		}
+		return elems, nil
+	}
+
+	for i := range n {
+		next, ok, err := ci.lookahead(i)
+		if err != nil {
+			return elems, err
+		}
+		if !ok {
+			break
+		}
+		elems = append(elems, next)
+	}
+
+	return elems, nil
+}
+
+// lookahead returns the element i positions after the next one, and whether
+// there is one, reading it from the source of ci without advancing ci. The
+// elements read are buffered, along with any peeked element, so they are
+// still yielded in order by the following calls to Next.
+func (ci *Value[T]) lookahead(i int) (T, bool, error) {
+	var zero T
+	if ci.peeked {
+		ci.pending = append([]T{ci.peek}, ci.pending...)
+		ci.peek, ci.peeked = zero, false
+	}
+
+	for len(ci.pending) <= i {
+		// Move the buffered elements aside, since checkNext and fetch would
+		// return them instead of reading from the source.
+		pending := ci.pending
+		ci.pending = nil
+
+		ok, err := ci.checkNext()
+		if err != nil {
+			ci.pending = pending
+			return zero, false, &Err{Op: "checking for next element", Err: err}
+		}
+		if !ok {
+			ci.pending = pending
+			ci.drained = len(pending) == 0
+			return zero, false, nil
+		}
+
+		next, err := ci.fetch()
+		ci.pending = pending
+		if err != nil {
+			return zero, false, &Err{Op: "getting next element", Err: err}
+		}
+		ci.pending = append(ci.pending, next)
+	}
+
+	return ci.pending[i], true, nil
+}
+
+// writePreviewSep writes the separator before the i-th element of a preview.
+func writePreviewSep(sb *strings.Builder, i int) {
+	if i > 0 {
+		sb.WriteString(", ")
+	}
+}
+
+// Value returns the current element of the iterable, or nil before the
+// first call to Next, so the zero value of T isn't mistaken for an element.
+func (ci *Value[T]) Value() any {
+	if ci.index < 0 {
+		return nil
+	}
+
+	return ci.cur
+}
+
+// Index returns the position of the current element of the iterable, which
+// is -1 before the first call to Next, 0 after it, and so on.
+func (ci *Value[T]) Index() int {
+	defer ci.lock()()
+
+	return ci.index
+}
+
+// Next retrieves the next element in the iterable value.
+func (ci *Value[T]) Next() ref.Val {
+	defer ci.lock()()
+
+	next := ci.nextVal()
+	ci.logf("Next() at index %d: %v", ci.index, next)
+	return next
+}
+
+// nextVal retrieves the next element without taking the lock, for use by
+// methods that already hold it.
+//
+// Unless the value was created with WithoutRecover, a panic in the next or
+// convert functions is returned as a CEL error.
+func (ci *Value[T]) nextVal() (val ref.Val) {
+	if ci.onNext != nil || ci.onError != nil {
+		defer func() {
+			if err, ok := val.(*types.Err); ok {
+				ci.reportError(err)
+			} else if ci.onNext != nil {
+				ci.onNext(ci.index, val)
+			}
+		}()
+	}
+
+	if ci.recover {
+		defer func() {
+			if r := recover(); r != nil {
+				val = types.NewErr("panic getting next element: %v", r)
+			}
+		}()
+	}
+
+	next, err := ci.advance()
+	if err != nil {
+		return types.WrapErr(&Err{Op: "getting next element", Err: err})
+	}
+
+	return ci.convert(next)
+}
+
+// advance moves the iterable value to its next element, returning the
+// element before it is converted.
+func (ci *Value[T]) advance() (T, error) {
+	var next T
+	if ci.peeked {
+		next, ci.peeked = ci.peek, false
+	} else {
+		var err error
+		next, err = ci.fetch()
+		if err != nil {
+			return next, err
+		}
+	}
+
+	ci.cur = next
+
+	ci.index++
+
+	if ci.cache {
+		ci.cached = append(ci.cached, next)
+	}
+
+	return next, nil
+}
+
+// fetch gets the next element from the underlying source, or the elements
+// buffered by lookahead first, without updating the position of the iterable
+// value.
+func (ci *Value[T]) fetch() (T, error) {
+	if len(ci.pending) > 0 {
+		next := ci.pending[0]
+		ci.pending = ci.pending[1:]
+		return next, nil
+	}
+
+	if ci.ctx != nil && ci.ctx.Err() != nil {
+		var zero T
+		return zero, ci.ctx.Err()
+	}
+
+	if ci.paced {
+		ci.paced = false
+	} else if err := ci.wait(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return ci.next()
+}
+
+// wait blocks until the interval set with WithRateLimit has passed since the
+// last element was fetched, or the context set with WithContext is done.
+func (ci *Value[T]) wait() error {
+	if ci.rateLimit <= 0 {
+		return nil
+	}
+
+	if !ci.lastFetch.IsZero() {
+		if d := ci.rateLimit - time.Since(ci.lastFetch); d > 0 {
+			ctx := ci.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	ci.lastFetch = time.Now()
+	return nil
+}
+
+// HasNext checks if there is a next element in the iterable value.
+func (ci *Value[T]) HasNext() ref.Val {
+	defer ci.lock()()
+
+	hasNext := ci.hasNextVal()
+	ci.logf("HasNext() after index %d: %v", ci.index, hasNext)
+	return hasNext
+}
+
+// hasNextVal checks if there is a next element without taking the lock, for
+// use by methods that already hold it.
+func (ci *Value[T]) hasNextVal() ref.Val {
+	hasNext, err := ci.checkNext()
+	if err != nil {
+		err = &Err{Op: "checking for next element", Err: err}
+		ci.reportError(err)
+		return types.WrapErr(err)
+	}
+
+	return types.Bool(hasNext)
+}
+
+// logf logs a message with the function set with WithLogger, if any.
+func (ci *Value[T]) logf(format string, args ...any) {
+	if ci.logger != nil {
+		ci.logger(format, args...)
+	}
+}
+
+// reportError calls the function set with WithOnError, if any.
+func (ci *Value[T]) reportError(err error) {
+	if ci.onError != nil {
+		ci.onError(err)
+	}
+}
+
+// lock acquires the mutex set by WithMutex, returning the function that
+// releases it. Without WithMutex, it does nothing.
+func (ci *Value[T]) lock() (unlock func()) {
+	if ci.mu == nil {
+		return func() {}
+	}
+
+	ci.mu.Lock()
+	return ci.mu.Unlock
+}
+
+// checkNext reports whether there is a next element in the iterable value.
+func (ci *Value[T]) checkNext() (bool, error) {
+	if ci.peeked || len(ci.pending) > 0 {
+		return true, nil
+	}
+
+	if ci.ctx != nil && ci.ctx.Err() != nil {
+		return false, ci.ctx.Err()
+	}
+
+	// Many sources, like FromSeq, read the next element when checking for
+	// it, so the wait for the rate limit happens here, and fetch skips it.
+	if !ci.paced {
+		if err := ci.wait(); err != nil {
+			return false, err
+		}
+		ci.paced = ci.rateLimit > 0
+	}
+
+	ok, err := ci.hasNext()
+	if err == nil && !ok {
+		ci.drained = true
+	}
+	return ok, err
+}
+
+// Peek returns the next element without advancing the iterable value, and
+// whether there is one. The element is buffered, so the following call to
+// Next returns the same element, and repeated calls to Peek don't advance
+// the underlying source.
+//
+// If checking for or getting the next element fails, the CEL error value is
+// returned along with false.
+func (ci *Value[T]) Peek() (ref.Val, bool) {
+	defer ci.lock()()
+
+	if !ci.peeked {
+		hasNext := ci.hasNextVal()
+		ci.logf("HasNext() after index %d: %v", ci.index, hasNext)
+		if hasNext != types.True {
+			return hasNext, false
+		}
+
+		next, err := ci.fetch()
+		if err != nil {
+			return types.WrapErr(&Err{Op: "getting next element", Err: err}), false
+		}
+
+		ci.peek, ci.peeked = next, true
+	}
+
+	return ci.convert(ci.peek), true
+}
+
+// IsEmpty reports whether the iterable value has no remaining elements. It
+// only checks for the next element, without advancing the iterable, so unlike
+// comparing the Size with zero it can be used with infinite sources. The next
+// element is buffered like with Peek, so calling IsEmpty any number of times
+// doesn't skip elements, and the following call to Next returns it.
+//
+// If checking for or getting the next element fails, the CEL error value is
+// returned.
+func (ci *Value[T]) IsEmpty() ref.Val {
+	next, ok := ci.Peek()
+	if !ok && types.IsError(next) {
+		return next
+	}
+
+	return types.Bool(!ok)
+}
+
+// Iterator returns the current iterable value, satisfying the traits.Iterator interface.
+//
+// Iteration continues from the current position, so a macro over a value that
+// was already drained, like by Size, sees no elements: "all" is vacuously
+// true and "exists" is false. Call Reset first to iterate from the start, or
+// create the value with WithResetOnIterate. If resetting fails, the error is
+// passed to the WithOnError hook and iteration continues from the current
+// position. Nested macros over the same single-pass value, like
+// "values().exists(x, values().exists(y, x == y))", share its position, so
+// the inner macro consumes the elements of the outer one.
+//
+// Repeatable values return a new iterator starting from the first element
+// instead, so they can be iterated any number of times, and nested macros
+// each see every element. Values with random access, like the ones created
+// by FromSlice or Materialize, iterate over their elements directly, and
+// values created with WithCache replay the cached elements before advancing
+// the value for more. These iterators keep the options of the value, like
+// its context, hooks, and logger, so macros over them behave the same way.
+func (ci *Value[T]) Iterator() traits.Iterator {
+	if ci.at != nil {
+		return fromIndex(ci.length, ci.at, ci.convert, ci.settings()...)
+	}
+
+	if ci.cache {
+		return ci.cursor()
+	}
+
+	if ci.resetOnIter && (ci.index >= 0 || ci.peeked) {
+		if err := ci.Reset(); err != nil {
+			ci.reportError(err)
+		}
+	}
+
+	return ci
+}
+
+// cursor returns a new iterable value which yields the cached elements of ci
+// from the first one, then advances ci for more, which are cached for other
+// cursors in turn.
+func (ci *Value[T]) cursor() *Value[T] {
+	var i int
+
+	hasNext := func() (bool, error) {
+		defer ci.lock()()
+		if i < len(ci.cached) {
+			return true, nil
+		}
+		return ci.checkNext()
+	}
+
+	next := func() (T, error) {
+		defer ci.lock()()
+		var zero T
+		if i >= len(ci.cached) {
+			if _, err := ci.advance(); err != nil {
+				return zero, err
+			}
+		}
+		if i >= len(ci.cached) {
+			return zero, fmt.Errorf("no next element")
+		}
+		i++
+		return ci.cached[i-1], nil
+	}
+
+	restart := func() error {
+		i = 0
+		return nil
+	}
+
+	// Reading past the cache advances ci, which already waits for its own
+	// rate limit, so replaying cached elements isn't slowed down.
+	opts := append(ci.settings(), WithRateLimit(0), WithRestart(restart))
+	return New(hasNext, next, ci.convert, opts...)
+}
+
+// settings returns the options which make a value derived from ci, like the
+// iterators returned by Iterator, report, log, and pace its elements the
+// same way as ci, and stop once its context is done.
+func (ci *Value[T]) settings() []Option {
+	opts := []Option{
+		WithAdapter(ci.adapter),
+		WithContext(ci.ctx),
+		WithContainsComparator(ci.containsEqual),
+		WithOnNext(ci.onNext),
+		WithOnError(ci.onError),
+		WithLogger(ci.logger),
+		WithRateLimit(ci.rateLimit),
+	}
+	if !ci.recover {
+		opts = append(opts, WithoutRecover())
+	}
+	return opts
+}
+
+// Get retrieves the value at the given key index, allowing for random access of the
+// iterable value using an index value (like an array).
+//
+// Indexes before the current position can only be retrieved if the value was
+// created with WithCache, and negative indexes if it was created with
+// WithNegativeIndex. Values created with FromMap can also be indexed by key.
+//
+// Getting an index before the current position of a value which was already
+// drained, like by Size, returns an error saying the iterable was consumed,
+// since its elements can only be retrieved again after a Reset.
+func (v *Value[T]) Get(key ref.Val) ref.Val {
+	defer v.lock()()
+
+	val := v.get(key)
+	v.logf("Get(%v) at index %d: %v", key, v.index, val)
+	return val
+}
+
+// get retrieves the value at the given key without taking the lock, see Get.
+func (v *Value[T]) get(key ref.Val) ref.Val {
+	if v.lookup != nil {
+		if val := v.lookup(key, v.convert); val != nil {
+			return val
+		}
+	}
+
+	keyIndex, errVal := keyToIndex(key)
+	if errVal != nil {
+		return errVal
+	}
+	if v.at != nil {
+		length := v.length()
+		if keyIndex < 0 {
+			if !v.negativeIndex {
+				return types.NewErr("index cannot be negative")
+			}
+			keyIndex += length
+		}
+		if keyIndex < 0 || keyIndex >= length {
+			return types.NewErr("index out of bounds during iterable access")
+		}
+		return v.convert(v.at(keyIndex))
+	}
+	if keyIndex < 0 {
+		if !v.negativeIndex {
+			return types.NewErr("index cannot be negative")
+		}
+		for {
+			hasNext := v.hasNextVal()
+			if types.IsError(hasNext) {
+				return hasNext
+			}
+			if hasNext != types.True {
+				break
+			}
+			if v.sizeLimit > 0 && v.index+1 >= v.sizeLimit {
+				return types.NewErr("unable to resolve negative index: size exceeded maximum of %d", v.sizeLimit)
+			}
+			if next := v.nextVal(); types.IsError(next) {
+				return next
+			}
+		}
+		keyIndex += v.index + 1
+		if keyIndex < 0 {
+			return types.NewErr("index out of bounds during iterable access")
+		}
+		return v.convert(v.cached[keyIndex])
+	}
+
+	if keyIndex < v.index {
+		if v.cache {
+			return v.convert(v.cached[keyIndex])
+		}
+		if v.drained {
+			return types.NewErr("index already passed: iterable already consumed; use WithCache or a restartable source")
+		}
+		return types.NewErr("index already passed")
+	}
+
+	for v.index < keyIndex {
+		hasNext := v.hasNextVal()
+		if types.IsError(hasNext) {
+			return hasNext
+		}
+		if hasNext != types.True {
+			return types.NewErr("index out of bounds during iterable access")
+		}
+		if next := v.nextVal(); types.IsError(next) {
+			return next
+		}
+	}
+
+	return v.convert(v.cur)
+}
+
+// keyToIndex converts a CEL key to an index, accepting ints, uints, and
+// doubles which are whole numbers, like "values()[2u]" or "values()[2.0]".
+func keyToIndex(key ref.Val) (int, ref.Val) {
+	switch k := key.(type) {
+	case types.Int:
+		return int(k), nil
+	case types.Uint:
+		if uint64(k) > math.MaxInt64 {
+			return 0, types.NewErr("invalid key value for iterable: %v, overflows int", k)
+		}
+		return int(k), nil
+	case types.Double:
+		f := float64(k)
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, types.NewErr("invalid key value for iterable: %v, must be a whole number", k)
+		}
+		return int(f), nil
+	}
+
+	return 0, types.NewErr("invalid key type for iterable: %s, must be int, uint, or double", key.Type())
+}
+
+// SizeHint returns the number of remaining elements of the iterable value,
+// and whether it is known, like for values created with FromSlice.
+func (v *Value[T]) SizeHint() (int, bool) {
+	if v.sizeHint == nil {
+		return 0, false
+	}
+
+	n, ok := v.sizeHint()
+	if !ok {
+		return 0, false
+	}
+	return n + len(v.pending), true
+}
+
+// Size returns the size of the iterable value, which includes the elements
+// already consumed, like by a prior Get, so "values()[1] == 'b' &&
+// size(values()) == 3" holds for a value with three elements.
+//
+// If the number of remaining elements is known (see SizeHint), the size is
+// returned without advancing the iterable. Otherwise, the remaining elements
+// are drained to count them.
+//
+// If a limit was set with WithSizeLimit, an error is returned once the
+// iterable has more elements than the limit.
+func (v *Value[T]) Size() ref.Val {
+	defer v.lock()()
+
+	return v.size(context.Background())
+}
+
+// SizeContext returns the size of the iterable value like Size, but stops
+// counting once ctx is done, returning a CEL error wrapping its error. This
+// bounds how long counting a slow or infinite source can take, independently
+// of any context set with WithContext. The context is checked before each
+// element, so a source blocked fetching one isn't interrupted.
+func (v *Value[T]) SizeContext(ctx context.Context) ref.Val {
+	defer v.lock()()
+
+	return v.size(ctx)
+}
+
+// size counts the elements of the iterable value, checking ctx before each
+// remaining element, see Size.
+func (v *Value[T]) size(ctx context.Context) ref.Val {
+	// Count in an int64, matching the CEL int, so the size can't overflow
+	// on platforms where int is 32 bits.
+	size := int64(v.index) + 1
+	limit := int64(v.sizeLimit)
+	if remaining, ok := v.SizeHint(); ok {
+		size += int64(remaining)
+		if limit > 0 && size > limit {
+			return types.NewErr("size exceeded maximum of %d", v.sizeLimit)
+		}
+		return types.Int(size)
+	}
+
+	for {
+		if errVal := ctxDone(ctx, "computing size"); errVal != nil {
+			return errVal
+		}
+		hasNext := v.hasNextVal()
+		if types.IsError(hasNext) {
+			return hasNext
+		}
+		if hasNext != types.True {
+			break
+		}
+		if limit > 0 && size >= limit {
+			return types.NewErr("size exceeded maximum of %d", v.sizeLimit)
+		}
+		if next := v.nextVal(); types.IsError(next) {
+			return next
+		}
+		size++
+	}
+
+	return types.Int(size)
+}
+
+// ToList drains the remaining elements of the iterable value into a CEL list,
+// which is useful when registering functions that need to return a list.
+//
+// If iteration fails, the CEL error value is returned instead.
+func (v *Value[T]) ToList() ref.Val {
+	elems, errVal := v.elements()
+	if errVal != nil {
+		return errVal
+	}
+
+	return types.NewRefValList(v.adapter, elems)
+}
+
+// elements drains the remaining elements of the iterable, returning them as
+// CEL values. If iteration fails, the CEL error value is returned instead.
+func (v *Value[T]) elements() ([]ref.Val, ref.Val) {
+	var elems []ref.Val
+	for {
+		hasNext := v.HasNext()
+		if types.IsError(hasNext) {
+			return nil, hasNext
+		}
+		if hasNext != types.True {
+			return elems, nil
+		}
+		next := v.Next()
+		if types.IsError(next) {
+			return nil, next
+		}
+		elems = append(elems, next)
+	}
+}
+
+// Contains checks if the iterable value contains the given value, using the
+// comparator set with WithContainsComparator if there is one. Otherwise,
+// elements are compared with CEL's equality, so numbers of different types
+// are equal when they have the same value, like "1.0 in [1]".
+//
+// If a limit was set with WithSizeLimit, an error is returned once the
+// search passes the limit without finding a match.
+//
+// Contains advances the value until a match is found, so by default a later
+// check only sees the remaining elements. With WithCache, elements already
+// yielded are checked first, so repeated checks, like "'example' in values()"
+// twice in the same expression, give the same result.
+func (v *Value[T]) Contains(val ref.Val) ref.Val {
+	defer v.lock()()
+
+	return v.contains(context.Background(), val)
+}
+
+// ContainsContext checks if the iterable value contains the given value like
+// Contains, but stops searching once ctx is done, returning a CEL error
+// wrapping its error. Like SizeContext, the context is checked before each
+// element, independently of any context set with WithContext.
+func (v *Value[T]) ContainsContext(ctx context.Context, val ref.Val) ref.Val {
+	defer v.lock()()
+
+	return v.contains(ctx, val)
+}
+
+// contains searches the iterable value for val, checking ctx before each
+// element, see Contains.
+func (v *Value[T]) contains(ctx context.Context, val ref.Val) ref.Val {
+	const op = "checking if iterable contains value"
+
+	equal := v.containsEqual
+	if equal == nil {
+		equal = func(cur, target ref.Val) bool {
+			return cur.Equal(target) == types.True
+		}
+	}
+
+	if v.at != nil {
+		for i := range v.length() {
+			if errVal := ctxDone(ctx, op); errVal != nil {
+				return errVal
+			}
+			if v.sizeLimit > 0 && i >= v.sizeLimit {
+				return types.NewErr("unable to check if iterable contains value: size exceeded maximum of %d", v.sizeLimit)
+			}
+			if equal(v.convert(v.at(i)), val) {
+				return types.True
+			}
+		}
+		return types.False
+	}
+
+	if v.cache {
+		for _, cached := range v.cached {
+			if equal(v.convert(cached), val) {
+				return types.True
+			}
 		}
 	}
 
-	if convert == nil {
-		convert = func(t T) ref.Val {
-			return types.DefaultTypeAdapter.NativeToValue(t)
+	for {
+		if errVal := ctxDone(ctx, op); errVal != nil {
+			return errVal
+		}
+		hasNext := v.hasNextVal()
+		if types.IsError(hasNext) {
+			return hasNext
+		}
+		if hasNext != types.True {
+			break
+		}
+		if v.sizeLimit > 0 && v.index+1 >= v.sizeLimit {
+			return types.NewErr("unable to check if iterable contains value: size exceeded maximum of %d", v.sizeLimit)
+		}
+		next := v.nextVal()
+		if types.IsError(next) {
+			return next
+		}
+		if equal(next, val) {
+			return types.True
 		}
 	}
 
-	return &Value[T]{
-		hasNext: hasNext,
-		next:    next,
-		convert: convert,
-		index:   -1,
-	}
+	return types.False
 }
 
-// Value represents an iterable value in CEL expressions.
-type Value[T any] struct {
-	index   int
-	cur     T
-	hasNext HasNext
-	next    Next[T]
-	convert Convert[T]
+// ctxDone returns a CEL error wrapping the error of ctx for op if it is done,
+// or nil otherwise.
+func ctxDone(ctx context.Context, op string) ref.Val {
+	if err := ctx.Err(); err != nil {
+		return types.WrapErr(&Err{Op: op, Err: err})
+	}
+
+	return nil
 }
 
-// ConvertToNative converts the current iterable value to a native Go type.
-func (v *Value[T]) ConvertToNative(typ reflect.Type) (any, error) {
-	nativeValue := v.cur
-	if reflect.TypeOf(nativeValue).AssignableTo(typ) {
-		return nativeValue, nil
+// Reset restarts iteration from the first element, so the value can be
+// iterated again after operations like Size or Contains have drained it.
+//
+// An error is returned if the value was not created with a restartable source,
+// see WithRestart.
+func (v *Value[T]) Reset() error {
+	if v.restart == nil {
+		return fmt.Errorf("unable to reset %s: no restart function", v.Type().TypeName())
 	}
-	return nil, fmt.Errorf("unable to convert %s to native type %s", v.Type().TypeName(), typ.Name())
-}
 
-// ConvertToType converts the current iterable value to a ref.Val type.
-func (ci *Value[T]) ConvertToType(typ ref.Type) ref.Val {
-	return types.NewErr(fmt.Sprintf("unable to convert %s to type %s", ci.Type().TypeName(), typ.TypeName()))
+	if err := v.restart(); err != nil {
+		return fmt.Errorf("error restarting iterable: %w", err)
+	}
+
+	var zero T
+	v.cur = zero
+	v.index = -1
+	v.cached = nil
+	v.peek, v.peeked = zero, false
+	v.pending = nil
+	v.drained = false
+	v.paced = false
+
+	return nil
 }
 
-// Equal checks if the current iterable value is equal to another ref.Val type.
-func (ci *Value[T]) Equal(other ref.Val) ref.Val {
-	if otherValue, ok := other.(*Value[T]); ok {
-		return types.Bool(ci == otherValue)
+// Materialize drains the remaining elements of the iterable value and keeps
+// them, so the value behaves like a list from then on: Get can access the
+// elements in any order, Size and Contains don't advance the value, and
+// every iteration, like each macro in an expression, starts from the first
+// element. Calling Materialize again has no effect.
+//
+// Values created with WithCache keep the elements already yielded, along with
+// their position, so Get and Size still include them. Otherwise, only the
+// remaining elements are kept, starting from the first one.
+//
+// Materialize never returns for infinite sources, unless a limit is set with
+// WithSizeLimit, in which case an error is returned once it is exceeded.
+func (v *Value[T]) Materialize() error {
+	defer v.lock()()
+
+	if v.at != nil {
+		return nil
 	}
 
-	return types.False
+	index, cur := v.index, v.cur
+
+	items, err := v.drain()
+	if err != nil {
+		return fmt.Errorf("unable to materialize %s: %w", v.Type().TypeName(), err)
+	}
+
+	var zero T
+	if v.cache {
+		// Draining a cached value appends each element to the cache, so it
+		// already holds every element, including the ones yielded before.
+		items = v.cached
+		v.cur, v.index = cur, index
+	} else {
+		v.cur, v.index = zero, -1
+	}
+	v.peek, v.peeked = zero, false
+	v.cache, v.cached = false, nil
+	v.setIndex(func() int {
+		return len(items)
+	}, func(i int) T {
+		return items[i]
+	})
+
+	return nil
 }
 
-// Type returns the type of the iterable value.
-func (ci *Value[T]) Type() ref.Type {
-	return Type
+// fromIndex creates a new iterable Value instance with random access, which
+// yields the elements from at(0) to at(length()-1). See setIndex.
+func fromIndex[T any](length func() int, at func(int) T, convert Convert[T], opts ...Option) *Value[T] {
+	v := New(nil, nil, convert, opts...)
+	v.setIndex(length, at)
+	return v
 }
 
-// Value returns the current value of the iterable.
-func (ci *Value[T]) Value() any {
-	return ci.cur
+// setIndex makes the iterable value yield the elements from at(0) to
+// at(length()-1), allowing Get, Size, and Contains to access them directly
+// without advancing the value, and Iterator to start from the first element.
+func (v *Value[T]) setIndex(length func() int, at func(int) T) {
+	v.length, v.at = length, at
+	v.hasNext = func() (bool, error) {
+		return v.index+1 < length(), nil
+	}
+	v.next = func() (T, error) {
+		if v.index+1 >= length() {
+			var zero T
+			return zero, fmt.Errorf("no next element")
+		}
+		return at(v.index + 1), nil
+	}
+	v.restart = func() error {
+		return nil
+	}
+	v.sizeHint = func() (int, bool) {
+		return length() - v.index - 1, true
+	}
+	v.clone = func() *Value[T] {
+		c := fromIndex(length, at, v.convert, v.settings()...)
+		v.copyLimits(c)
+		return c
+	}
 }
 
-// Next retrieves the next element in the iterable value.
-func (ci *Value[T]) Next() ref.Val {
-	next, err := ci.next()
-	if err != nil {
-		return types.NewErr("error getting next element: %w", err)
+// drain advances the iterable value until it is exhausted, returning the
+// elements before they are converted. If a limit was set with WithSizeLimit,
+// an error is returned once it is exceeded.
+func (v *Value[T]) drain() ([]T, error) {
+	var elems []T
+	for {
+		ok, err := v.checkNext()
+		if err != nil {
+			return nil, &Err{Op: "checking for next element", Err: err}
+		}
+		if !ok {
+			return elems, nil
+		}
+		if v.sizeLimit > 0 && len(elems) >= v.sizeLimit {
+			return nil, fmt.Errorf("size exceeded maximum of %d", v.sizeLimit)
+		}
+		next, err := v.advance()
+		if err != nil {
+			return nil, &Err{Op: "getting next element", Err: err}
+		}
+		elems = append(elems, next)
 	}
+}
 
-	ci.cur = next
+// Clone returns a copy of the iterable value at the same position, which can
+// be advanced independently of v. An error is returned for values which can't
+// be cloned, like the ones created with FromMapKeys or FromMapValues, whose
+// order may change between iterations.
+//
+// Values with random access, like the ones created by FromSlice or
+// Materialize, and values created with FromSeq or FromSeqFunc are cloned by
+// replaying their source from the first element up to the position of v, so
+// the sequence must yield the same elements every time it is iterated.
+//
+// Values created with WithCache are cloned from their cache instead, so their
+// source is never replayed. Elements past the position of v are read from the
+// source once, and buffered until both v and the copy have yielded them.
+func (v *Value[T]) Clone() (*Value[T], error) {
+	if v.at == nil && v.cache {
+		defer v.lock()()
+		return v.cloneCache(), nil
+	}
 
-	ci.index++
+	if v.clone == nil {
+		return nil, fmt.Errorf("unable to clone %s: source cannot be replayed", v.Type().TypeName())
+	}
 
-	return ci.convert(next)
-}
+	defer v.lock()()
 
-// HasNext checks if there is a next element in the iterable value.
-func (ci *Value[T]) HasNext() ref.Val {
-	hasNext, err := ci.hasNext()
-	if err != nil {
-		return types.NewErr("error checking for next element: %w", err)
+	clone := v.clone()
+	// The source may have been created with another converter, see
+	// WithConverter.
+	clone.convert = v.convert
+	for clone.index < v.index {
+		ok, err := clone.checkNext()
+		if err != nil {
+			return nil, &Err{Op: "checking for next element", Err: err}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unable to clone %s: source ended before index %d", v.Type().TypeName(), v.index)
+		}
+		if _, err := clone.advance(); err != nil {
+			return nil, &Err{Op: "getting next element", Err: err}
+		}
 	}
 
-	return types.Bool(hasNext)
+	if v.peeked {
+		ok, err := clone.checkNext()
+		if err != nil {
+			return nil, &Err{Op: "checking for next element", Err: err}
+		}
+		if ok {
+			clone.peek, err = clone.fetch()
+			if err != nil {
+				return nil, &Err{Op: "getting next element", Err: err}
+			}
+			clone.peeked = true
+		}
+	}
+
+	return clone, nil
 }
 
-// Iterator returns the current iterable value, satisfying the traits.Iterator interface.
-func (ci *Value[T]) Iterator() traits.Iterator {
-	return ci
+// cloneCache returns a copy of v which yields its cached elements, then the
+// elements after its position, see Clone.
+func (v *Value[T]) cloneCache() *Value[T] {
+	// elem returns the element of v at index i, reading it ahead of v if it
+	// is past its position.
+	elem := func(i int) (T, bool, error) {
+		defer v.lock()()
+		if i < len(v.cached) {
+			return v.cached[i], true, nil
+		}
+		return v.lookahead(i - len(v.cached))
+	}
+
+	// The position is kept here rather than read from the copy, so shallow
+	// copies of it, like the ones made by WithConverter, still advance.
+	var (
+		i    = v.index + 1
+		next T
+	)
+
+	hasNext := func() (bool, error) {
+		var (
+			ok  bool
+			err error
+		)
+		next, ok, err = elem(i)
+		return ok, err
+	}
+
+	getNext := func() (T, error) {
+		i++
+		return next, nil
+	}
+
+	restart := func() error {
+		i = 0
+		return nil
+	}
+
+	c := New(hasNext, getNext, v.convert, append(v.settings(), WithCache(), WithRestart(restart))...)
+	v.copyLimits(c)
+	c.index, c.cur = v.index, v.cur
+	c.cached = append(c.cached, v.cached...)
+
+	return c
 }
 
-// Get retrieves the value at the given key index, allowing for random access of the
-// iterable value using an index value (like an array).
-func (v *Value[T]) Get(key ref.Val) ref.Val {
-	if key.Type() != types.IntType {
-		return types.NewErr("invalid key type for iterable: %s, must be int", key.Type())
+// copyLimits sets up c, a copy of v, to resolve negative indexes, limit its
+// size, and guard its methods with a mutex like v, which settings leaves out
+// since iterators over v don't need them.
+func (v *Value[T]) copyLimits(c *Value[T]) {
+	c.negativeIndex = v.negativeIndex
+	c.sizeLimit = v.sizeLimit
+	if v.mu != nil {
+		c.mu = &sync.Mutex{}
 	}
+}
 
-	keyValue := key.Value()
-	keyIndex := int(keyValue.(int64))
-	if keyIndex < 0 {
-		return types.NewErr("index cannot be negative")
+// Seek advances the iterable value to just before the element at index n,
+// discarding the elements in between, so the following Next yields that
+// element. Values with random access, like the ones created by FromSlice,
+// move there directly.
+//
+// Seeking only moves forward, so an error is returned if the element at n
+// was already yielded, or if the iterable ends before reaching it.
+func (v *Value[T]) Seek(n int) error {
+	defer v.lock()()
+
+	if n <= v.index {
+		return fmt.Errorf("unable to seek to index %d: already at index %d", n, v.index)
 	}
 
-	if keyIndex < v.index {
-		return types.NewErr("index already passed")
+	if v.at != nil {
+		if n > v.length() {
+			return fmt.Errorf("unable to seek to index %d: out of bounds", n)
+		}
+		var zero T
+		v.index, v.cur = n-1, zero
+		if n > 0 {
+			v.cur = v.at(v.index)
+		}
+		v.peek, v.peeked = zero, false
+		return nil
 	}
 
-	for v.index < keyIndex {
-		if !v.HasNext().Value().(bool) {
-			return types.NewErr("index out of bounds during iterable access")
+	for v.index < n-1 {
+		ok, err := v.checkNext()
+		if err != nil {
+			return &Err{Op: "checking for next element", Err: err}
+		}
+		if !ok {
+			return fmt.Errorf("unable to seek to index %d: out of bounds", n)
+		}
+		if _, err := v.advance(); err != nil {
+			return &Err{Op: "getting next element", Err: err}
 		}
-		v.Next()
 	}
 
-	return v.convert(v.cur)
+	return nil
 }
 
-// Size returns the size of the iterable value.
-func (v *Value[T]) Size() ref.Val {
-	size := 0
-	for v.HasNext().Value().(bool) {
-		v.Next()
-		size++
-	}
+// Drain advances the iterable value until it is exhausted, discarding the
+// elements without converting or keeping them, which is useful for sources
+// with side effects. It never returns for infinite sources.
+//
+// If checking for or getting the next element fails, draining stops and the
+// error is returned as an Err.
+func (v *Value[T]) Drain() error {
+	_, err := Reduce(v, struct{}{}, func(acc struct{}, _ T) struct{} {
+		return acc
+	})
+	return err
+}
 
-	return types.Int(size)
+// WithConverter returns a shallow copy of v which yields its elements
+// converted with convert instead, like to wrap them in another CEL value. The
+// elements themselves are unchanged, and v keeps its own converter. The copy
+// keeps every option of v, like its size limit, cache, and hooks, and values
+// with random access keep it too.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func (v *Value[T]) WithConverter(convert Convert[T]) *Value[T] {
+	defer v.lock()()
+
+	w := *v
+	w.convert = convert
+	if v.at != nil {
+		// The random access functions refer to the position of v, so they
+		// are set up again to use the position of the copy.
+		w.setIndex(v.length, v.at)
+	}
+	return &w
 }
 
-// Contains checks if the iterable value contains the given value.
-func (v *Value[T]) Contains(val ref.Val) ref.Val {
-	for v.HasNext().Value().(bool) {
-		if v.Next().Equal(val) == types.True {
-			return types.True
-		}
+// Close releases any resources held by the underlying source of the iterable,
+// see WithClose. It is safe to call Close on values without a close function.
+//
+// Values created with FromSeq or FromSeqFunc should be closed once evaluation
+// is complete, because expressions that stop early, like an exists macro that
+// finds a match, leave the sequence suspended.
+func (v *Value[T]) Close() error {
+	if v.close == nil {
+		return nil
 	}
 
-	return types.False
+	if err := v.close(); err != nil {
+		return fmt.Errorf("error closing iterable: %w", err)
+	}
+
+	return nil
 }
 
 // FromSeq creates a new iterable Value instance from a sequence of elements,
 // which allows for simple interoperability between Go and CEL iterable types.
-func FromSeq[T any](seq iter.Seq[T], convert Convert[T]) *Value[T] {
-	var cur T
+//
+// The returned value can be reset, which pulls from seq again.
+func FromSeq[T any](seq iter.Seq[T], convert Convert[T], opts ...Option) *Value[T] {
+	return FromSeqFunc(func() iter.Seq[T] { return seq }, convert, opts...)
+}
 
-	next, stop := iter.Pull(seq)
+// FromSeqFunc creates a new iterable Value instance from a function that
+// returns a sequence of elements.
+//
+// The function is called lazily at the start of every iteration pass: once
+// when the value is first advanced, and again on the first advance after each
+// Reset. This allows sources that can't be replayed, like a sequence backed by
+// a single-use cursor, to be iterated more than once.
+//
+// Call Close when done with the value to stop a partially consumed sequence.
+func FromSeqFunc[T any](seqFn func() iter.Seq[T], convert Convert[T], opts ...Option) *Value[T] {
+	var (
+		cur    T
+		next   func() (T, bool)
+		stop   func()
+		closed bool
+	)
 
 	hasNext := func() (bool, error) {
+		if closed {
+			return false, nil
+		}
+		if next == nil {
+			next, stop = iter.Pull(seqFn())
+		}
 		var ok bool
 		cur, ok = next()
 		if !ok {
+			// Release the puller as soon as the sequence is exhausted, like
+			// when Get runs past the end, rather than waiting for Close.
 			stop()
+			closed = true
 		}
 		return ok, nil
 	}
@@ -205,21 +1606,73 @@ func FromSeq[T any](seq iter.Seq[T], convert Convert[T]) *Value[T] {
 		return cur, nil
 	}
 
-	value := New(hasNext, getNext, convert)
+	restart := func() error {
+		if stop != nil {
+			stop()
+		}
+		next, stop, closed = nil, nil, false
+		return nil
+	}
+
+	close := func() error {
+		if stop != nil {
+			stop()
+		}
+		next, stop, closed = nil, nil, true
+		return nil
+	}
+
+	value := New(hasNext, getNext, convert, append([]Option{WithRestart(restart), WithClose(close)}, opts...)...)
+	value.clone = func() *Value[T] {
+		return FromSeqFunc(seqFn, convert, opts...)
+	}
 
 	return value
 }
 
+// Pair is a key-value pair yielded by an iterable created with FromSeq2.
+type Pair[K, V any] struct {
+	Key   K
+	Value V
+}
+
+// FromSeq2 creates a new iterable Value instance from a sequence of key-value
+// pairs, like the ones returned by maps.All or slices.All.
+//
+// Each pair is converted to a single CEL value with convert. If convert is nil,
+// pairs are converted to a two element CEL list of the key and value.
+func FromSeq2[K, V any](seq iter.Seq2[K, V], convert func(K, V) ref.Val, opts ...Option) *Value[Pair[K, V]] {
+	if convert == nil {
+		adapter := applyOptions(opts...).adapter
+		convert = func(k K, v V) ref.Val {
+			return types.NewDynamicList(adapter, []any{k, v})
+		}
+	}
+
+	pairs := func(yield func(Pair[K, V]) bool) {
+		for k, v := range seq {
+			if !yield(Pair[K, V]{Key: k, Value: v}) {
+				return
+			}
+		}
+	}
+
+	return FromSeq(pairs, func(p Pair[K, V]) ref.Val {
+		return convert(p.Key, p.Value)
+	}, opts...)
+}
+
 // AsSeq converts a CEL iterable Value instance to a sequence of elements.
 //
 // # Important
 //
 //  1. If the iterable is not a CEL iterable, an empty sequence is returned.
-//  2. If there are any errors during conversion, the sequence will be truncated,
-//     or the program could panic.
+//  2. If there are any errors during iteration, the sequence will be truncated
+//     before the failing element. If convert fails, the program could panic.
 //  3. Probably not a good idea to use this function in production code,
 //     but really useful for testing, debugging, and REPL-like environments
-//     where you want to quickly convert between CEL and Go types.
+//     where you want to quickly convert between CEL and Go types. Use AsSeqE
+//     to handle errors instead.
 func AsSeq[T any](val ref.Val, convert func(ref.Val) T) iter.Seq[T] {
 	if convert == nil {
 		convert = func(val ref.Val) T {
@@ -233,12 +1686,23 @@ func AsSeq[T any](val ref.Val, convert func(ref.Val) T) iter.Seq[T] {
 	}
 
 	hasNext := func() (bool, error) {
-		rv := iterVal.HasNext()
-		return fmt.Sprintf("%v", rv) == "true", nil
+		switch rv := iterVal.HasNext().(type) {
+		case types.Bool:
+			return bool(rv), nil
+		case *types.Err:
+			return false, rv
+		default:
+			return false, fmt.Errorf("unexpected result checking for next element: %v", rv)
+		}
 	}
 
 	getNext := func() (T, error) {
-		return convert(iterVal.Next()), nil
+		next := iterVal.Next()
+		if err, ok := next.(*types.Err); ok {
+			var zero T
+			return zero, err
+		}
+		return convert(next), nil
 	}
 
 	return func(yield func(T) bool) {
@@ -259,3 +1723,202 @@ func AsSeq[T any](val ref.Val, convert func(ref.Val) T) iter.Seq[T] {
 		}
 	}
 }
+
+// AsSeqE converts a CEL iterable Value instance to a sequence of elements,
+// each yielded along with the error converting it, if any. Unlike AsSeq,
+// errors are never hidden, so it is suitable for production code.
+//
+// A conversion error doesn't stop the sequence, so the consumer can decide
+// whether to skip the element or stop. If checking for or getting the next
+// element fails, or the value is not a CEL iterable, the error is yielded
+// and the sequence ends.
+//
+// If convert is nil, each element's native value is asserted to be a T.
+func AsSeqE[T any](val ref.Val, convert func(ref.Val) (T, error)) iter.Seq2[T, error] {
+	if convert == nil {
+		convert = func(val ref.Val) (T, error) {
+			t, ok := val.Value().(T)
+			if !ok {
+				return t, fmt.Errorf("unable to convert %s to %T", val.Type().TypeName(), t)
+			}
+			return t, nil
+		}
+	}
+
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		iterVal, ok := val.(traits.Iterator)
+		if !ok {
+			yield(zero, fmt.Errorf("unable to iterate over %s: not an iterator", val.Type().TypeName()))
+			return
+		}
+
+		for {
+			hasNext := iterVal.HasNext()
+			if err, ok := hasNext.(*types.Err); ok {
+				yield(zero, err)
+				return
+			}
+			if hasNext != types.True {
+				return
+			}
+
+			next := iterVal.Next()
+			if err, ok := next.(*types.Err); ok {
+				yield(zero, err)
+				return
+			}
+
+			if !yield(convert(next)) {
+				return
+			}
+		}
+	}
+}
+
+// AsSeqOf converts a CEL iterable Value instance to a sequence of elements,
+// converting each one with its ConvertToNative method, so unlike AsSeq, an
+// element of another type ends the sequence instead of panicking. Numbers can
+// be converted to other numeric types, like a CEL int to an int32, if the
+// element's value fits.
+//
+// The sequence also ends if checking for or getting the next element fails,
+// or if the value is not a CEL iterable. Use AsSeqE to handle errors instead.
+func AsSeqOf[T any](val ref.Val) iter.Seq[T] {
+	typ := reflect.TypeFor[T]()
+
+	convert := func(val ref.Val) (T, error) {
+		native, err := val.ConvertToNative(typ)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		t, ok := native.(T)
+		if !ok {
+			return t, fmt.Errorf("unable to convert %s to %v", val.Type().TypeName(), typ)
+		}
+		return t, nil
+	}
+
+	return func(yield func(T) bool) {
+		for t, err := range AsSeqE(val, convert) {
+			if err != nil || !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// AsSlice converts a CEL iterable Value instance to a slice of elements by
+// draining it, which is a safer alternative to AsSeq when the iterable may
+// fail.
+//
+// If the value is not a CEL iterable, or checking for or getting an element
+// fails, an error is returned along with the elements collected so far.
+func AsSlice[T any](val ref.Val, convert func(ref.Val) T) ([]T, error) {
+	if convert == nil {
+		convert = func(val ref.Val) T {
+			return val.Value().(T)
+		}
+	}
+
+	iterVal, ok := val.(traits.Iterator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %s to slice: not an iterator", val.Type().TypeName())
+	}
+
+	var elems []T
+	for {
+		hasNext := iterVal.HasNext()
+		if err, ok := hasNext.(*types.Err); ok {
+			return elems, err
+		}
+		if hasNext != types.True {
+			return elems, nil
+		}
+
+		next := iterVal.Next()
+		if err, ok := next.(*types.Err); ok {
+			return elems, err
+		}
+
+		elems = append(elems, convert(next))
+	}
+}
+
+// AsChannel converts a CEL iterable Value instance to a channel of elements,
+// which is the inverse of FromChannel. A goroutine drains val into the
+// channel, which has a buffer of bufSize elements, and closes it once val is
+// exhausted.
+//
+// The returned cancel function stops the goroutine early, and waits for it to
+// return, so val can be used again afterward. It should always be called
+// once the channel is no longer read, or the goroutine may block forever, and
+// it is safe to call more than once.
+//
+// The same caveats as AsSeq apply.
+func AsChannel[T any](val ref.Val, convert func(ref.Val) T, bufSize int) (<-chan T, func()) {
+	var (
+		ch   = make(chan T, bufSize)
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+
+		for t := range AsSeq(val, convert) {
+			select {
+			case ch <- t:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+
+	return ch, cancel
+}
+
+// AsSeq2 converts a CEL iterable Value instance to a sequence of key-value
+// pairs, which is the inverse of FromSeq2.
+//
+// If convert is nil, each element is expected to be a two element CEL list
+// of the key and value, like the default conversion used by FromSeq2.
+//
+// The same caveats as AsSeq apply.
+func AsSeq2[K, V any](val ref.Val, convert func(ref.Val) (K, V)) iter.Seq2[K, V] {
+	if convert == nil {
+		convert = func(val ref.Val) (K, V) {
+			pair := val.(traits.Indexer)
+			return pair.Get(types.Int(0)).Value().(K), pair.Get(types.Int(1)).Value().(V)
+		}
+	}
+
+	iterVal, ok := val.(traits.Iterator)
+	if !ok {
+		return func(yield func(K, V) bool) {}
+	}
+
+	return func(yield func(K, V) bool) {
+		for iterVal.HasNext() == types.True {
+			next := iterVal.Next()
+			if types.IsError(next) {
+				break
+			}
+
+			if !yield(convert(next)) {
+				break
+			}
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package celiter_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"iter"
+	"maps"
+	"math"
+	"reflect"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/common/decls"
@@ -59,6 +67,29 @@ func TestNew(t *testing.T) {
 				must.Error(t, err)
 			},
 		},
+		{
+			name: "uint index expression",
+			expr: "values()[2u] == 'sample'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "whole double index expression",
+			expr: "values()[1.0] == 'example'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "fractional double index expression",
+			expr: "values()[1.5] == 'example'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "must be a whole number")
+			},
+		},
 		{
 			name: "size expression",
 			expr: "size(values()) == 3",
@@ -226,6 +257,31 @@ func TestFromSeq(t *testing.T) {
 	}
 }
 
+func TestFromSeqOutOfBounds(t *testing.T) {
+	var stopped bool
+
+	val := celiter.FromSeq(func(yield func(string) bool) {
+		defer func() {
+			stopped = true
+		}()
+		for _, v := range []string{"test", "example", "sample"} {
+			if !yield(v) {
+				return
+			}
+		}
+	}, nil)
+
+	must.True(t, types.IsError(val.Get(types.Int(4))))
+	must.True(t, stopped)
+
+	// The exhausted sequence isn't pulled from again.
+	must.Eq[ref.Val](t, val.HasNext(), types.False)
+	must.True(t, types.IsError(val.Get(types.Int(4))))
+
+	must.NoError(t, val.Reset())
+	must.Eq[ref.Val](t, val.Get(types.Int(2)), types.String("sample"))
+}
+
 func TestAsSeq(t *testing.T) {
 	env, err := cel.NewEnv(
 		cel.Function(
@@ -319,3 +375,3304 @@ func Test_Seq_Fibonacci(t *testing.T) {
 
 	must.Eq(t, val.Value().(int64), 55)
 }
+
+func TestNextError(t *testing.T) {
+	errSentinel := errors.New("sentinel")
+
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{
+			name: "exists expression",
+			expr: "values().exists(x, x == 'test')",
+		},
+		{
+			name: "index expression",
+			expr: "values()[0] == 'test'",
+		},
+		{
+			name: "size expression",
+			expr: "size(values()) == 1",
+		},
+		{
+			name: "in expression",
+			expr: "'test' in values()",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							var called bool
+							return celiter.New(
+								func() (bool, error) {
+									return !called, nil
+								},
+								func() (string, error) {
+									called = true
+									return "", errSentinel
+								},
+								func(s string) ref.Val {
+									return types.String(s)
+								},
+							)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			_, _, err = prg.Eval(map[string]any{})
+			must.Error(t, err)
+			must.ErrorIs(t, err, errSentinel)
+		})
+	}
+}
+
+func TestNewE(t *testing.T) {
+	errBadValue := errors.New("bad value")
+
+	newValues := func() *celiter.Value[string] {
+		var (
+			values = []string{"test", "example", "sample"}
+			index  = 0
+		)
+
+		return celiter.NewE(
+			func() (bool, error) {
+				return index < len(values), nil
+			},
+			func() (string, error) {
+				val := values[index]
+				index++
+				return val, nil
+			},
+			func(s string) (ref.Val, error) {
+				if s == "example" {
+					return nil, errBadValue
+				}
+				return types.String(s), nil
+			},
+		)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "conversion error expression",
+			expr: "values().all(x, x != '')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorIs(t, err, errBadValue)
+				must.ErrorContains(t, err, "error converting next element")
+			},
+		},
+		{
+			name: "before conversion error expression",
+			expr: "values()[0] == 'test'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return newValues()
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestConvertToNative(t *testing.T) {
+	t.Run("nil current element", func(t *testing.T) {
+		val := celiter.New[any](nil, nil, nil)
+
+		native, err := val.ConvertToNative(reflect.TypeOf(""))
+		must.Error(t, err)
+		must.Nil(t, native)
+	})
+
+	t.Run("before first element", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test"}), nil)
+		must.Nil(t, val.Value())
+
+		native, err := val.ConvertToNative(reflect.TypeOf(""))
+		must.ErrorContains(t, err, "no current element")
+		must.Nil(t, native)
+	})
+
+	t.Run("assignable current element", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test"}), nil)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("test"))
+
+		native, err := val.ConvertToNative(reflect.TypeOf(""))
+		must.NoError(t, err)
+		must.Eq(t, native, any("test"))
+		must.Eq(t, val.Value(), any("test"))
+
+		must.NoError(t, val.Reset())
+		must.Nil(t, val.Value())
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]string{}))
+		must.NoError(t, err)
+		must.Eq(t, native, any([]string{"test", "example", "sample"}))
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("slice of remaining elements", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("test"))
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]any{}))
+		must.NoError(t, err)
+		must.Eq(t, native, any([]any{"example", "sample"}))
+	})
+
+	t.Run("slice with converted elements", func(t *testing.T) {
+		val := celiter.FromSlice([]int{1, 2, 3}, nil)
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]int64{}))
+		must.NoError(t, err)
+		must.Eq(t, native, any([]int64{1, 2, 3}))
+	})
+
+	t.Run("slice element mismatch", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]int64{}))
+		must.ErrorContains(t, err, "element 0")
+		must.Nil(t, native)
+	})
+
+	t.Run("slice limit", func(t *testing.T) {
+		val := celiter.Repeat("test", -1, nil, celiter.WithSizeLimit(10))
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]string{}))
+		must.ErrorContains(t, err, "size exceeded maximum of 10")
+		must.Nil(t, native)
+	})
+
+	t.Run("current slice element", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]any{[]any{1}, []any{2}}), nil)
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]any{}))
+		must.NoError(t, err)
+		must.Eq(t, native, any([]any{[]any{1}, []any{2}}))
+
+		val = celiter.FromSeq(slices.Values([]any{[]any{1}, []any{2}}), nil)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		val.Next()
+
+		native, err = val.ConvertToNative(reflect.TypeOf([]any{}))
+		must.NoError(t, err)
+		must.Eq(t, native, any([]any{1}))
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+	})
+
+	t.Run("slice elements", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([][]string{{"a"}, {"b"}}), nil)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		val.Next()
+
+		native, err := val.ConvertToNative(reflect.TypeOf([]string{}))
+		must.NoError(t, err)
+		must.Eq(t, native, any([]string{"a"}))
+	})
+}
+
+func TestReset(t *testing.T) {
+	t.Run("new with restart", func(t *testing.T) {
+		var (
+			values      = []string{"test", "example", "sample"}
+			valuesIndex = 0
+		)
+
+		val := celiter.New(
+			func() (bool, error) {
+				return valuesIndex < len(values), nil
+			},
+			func() (string, error) {
+				val := values[valuesIndex]
+				valuesIndex++
+				return val, nil
+			},
+			func(s string) ref.Val {
+				return types.String(s)
+			},
+			celiter.WithRestart(func() error {
+				valuesIndex = 0
+				return nil
+			}),
+		)
+
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.String("test"))
+	})
+
+	t.Run("new without restart", func(t *testing.T) {
+		val := celiter.New[string](nil, nil, nil)
+		must.Error(t, val.Reset())
+	})
+
+	t.Run("from seq", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Contains(types.String("sample")), types.True)
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Get(types.Int(1)), types.String("example"))
+	})
+}
+
+func TestFromSeqFunc(t *testing.T) {
+	var calls int
+
+	val := celiter.FromSeqFunc(
+		func() iter.Seq[string] {
+			calls++
+			return slices.Values([]string{"test", "example", "sample"})
+		},
+		func(v string) ref.Val {
+			return types.String(v)
+		},
+	)
+	must.Eq(t, calls, 0)
+
+	for pass := 1; pass <= 3; pass++ {
+		must.Eq(t, slices.Collect(celiter.AsSeq(val, func(v ref.Val) string {
+			return v.Value().(string)
+		})), []string{"test", "example", "sample"})
+		must.Eq(t, calls, pass)
+		must.NoError(t, val.Reset())
+	}
+
+	must.Eq[ref.Val](t, val.Size(), types.Int(3))
+	must.Eq(t, calls, 4)
+}
+
+func TestSizeLimit(t *testing.T) {
+	var naturals iter.Seq[int] = func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		seq   iter.Seq[int]
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "infinite sequence",
+			seq:  naturals,
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "size exceeded maximum of 1000")
+			},
+		},
+		{
+			name: "sequence within limit",
+			seq:  slices.Values(slices.Repeat([]int{1}, 1000)),
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, val.Value().(int64), 1000)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromSeq(
+								test.seq,
+								func(v int) ref.Val {
+									return types.Int(v)
+								},
+								celiter.WithSizeLimit(1000),
+							)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile("size(values())")
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestContainsLimit(t *testing.T) {
+	naturals := func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "missing element",
+			expr: "-1 in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "size exceeded maximum of 100")
+			},
+		},
+		{
+			name: "element within limit",
+			expr: "99 in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "element past limit",
+			expr: "100 in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "size exceeded maximum of 100")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[int] {
+					return celiter.FromSeq(naturals, nil, celiter.WithSizeLimit(100))
+				}),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("random access", func(t *testing.T) {
+		val := celiter.Range(0, math.MaxInt64, 1, nil, celiter.WithSizeLimit(100))
+		must.True(t, types.IsError(val.Contains(types.Int(-1))))
+		must.Eq[ref.Val](t, val.Contains(types.Int(99)), types.True)
+	})
+}
+
+func TestGetAfterDrain(t *testing.T) {
+	newValues := func() *celiter.Value[string] {
+		return celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+	}
+
+	t.Run("size then get", func(t *testing.T) {
+		val := newValues()
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+
+		got := val.Get(types.Int(0))
+		must.True(t, types.IsError(got))
+		must.StrContains(t, fmt.Sprintf("%v", got), "iterable already consumed; use WithCache or a restartable source")
+	})
+
+	t.Run("get passed index", func(t *testing.T) {
+		val := newValues()
+		must.Eq[ref.Val](t, val.Get(types.Int(1)), types.String("example"))
+
+		got := val.Get(types.Int(0))
+		must.True(t, types.IsError(got))
+		must.Eq(t, fmt.Sprintf("%v", got), "index already passed")
+	})
+
+	t.Run("size reset get", func(t *testing.T) {
+		val := newValues()
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.String("test"))
+	})
+
+	t.Run("size then get with cache", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil, celiter.WithCache())
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.String("test"))
+	})
+}
+
+func TestSizeLarge(t *testing.T) {
+	const n = 1 << 20
+
+	naturals := func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+
+	t.Run("count within limit", func(t *testing.T) {
+		val := celiter.Take(celiter.FromSeq(naturals, nil), n)
+		must.Eq[ref.Val](t, val.Size(), types.Int(n))
+	})
+
+	t.Run("count over limit", func(t *testing.T) {
+		val := celiter.FromSeq(naturals, nil, celiter.WithSizeLimit(n))
+		must.StrContains(t, fmt.Sprintf("%v", val.Size()), "size exceeded maximum of 1048576")
+	})
+
+	t.Run("hinted count", func(t *testing.T) {
+		must.Eq[ref.Val](t, celiter.Range(0, math.MaxInt64, 1, nil).Size(), types.Int(math.MaxInt64))
+	})
+
+	t.Run("hinted count over limit", func(t *testing.T) {
+		val := celiter.Range(0, math.MaxInt64, 1, nil, celiter.WithSizeLimit(math.MaxInt32))
+		must.True(t, types.IsError(val.Size()))
+	})
+}
+
+func TestSizeContainsContext(t *testing.T) {
+	slow := func() *celiter.Value[int] {
+		var i int
+		return celiter.New(
+			func() (bool, error) {
+				return true, nil
+			},
+			func() (int, error) {
+				time.Sleep(time.Millisecond)
+				i++
+				return i, nil
+			},
+			nil,
+		)
+	}
+
+	t.Run("size timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err, ok := celiter.AsError(slow().SizeContext(ctx))
+		must.True(t, ok)
+		must.ErrorIs(t, err, context.DeadlineExceeded)
+		must.ErrorContains(t, err, "error computing size")
+	})
+
+	t.Run("contains timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err, ok := celiter.AsError(slow().ContainsContext(ctx, types.Int(-1)))
+		must.True(t, ok)
+		must.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("contains before timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		must.Eq[ref.Val](t, slow().ContainsContext(ctx, types.Int(3)), types.True)
+	})
+
+	t.Run("size before timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		must.Eq[ref.Val](t, celiter.Take(slow(), 3).SizeContext(ctx), types.Int(3))
+	})
+
+	t.Run("canceled random access", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err, ok := celiter.AsError(celiter.Range(0, math.MaxInt64, 1, nil).ContainsContext(ctx, types.Int(-1)))
+		must.True(t, ok)
+		must.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name   string
+		expr   string
+		values []string
+		other  []string
+		check  func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name:   "equal iterables",
+			expr:   "values() == other()",
+			values: []string{"test", "example", "sample"},
+			other:  []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name:   "shorter iterable",
+			expr:   "values() == other()",
+			values: []string{"test", "example", "sample"},
+			other:  []string{"test", "example"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:   "longer iterable",
+			expr:   "values() == other()",
+			values: []string{"test", "example"},
+			other:  []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:   "element mismatch",
+			expr:   "values() == other()",
+			values: []string{"test", "example", "sample"},
+			other:  []string{"test", "sample", "example"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:   "equal list",
+			expr:   "values() == ['test', 'example', 'sample']",
+			values: []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name:   "shorter list",
+			expr:   "values() == ['test', 'example']",
+			values: []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:   "longer list",
+			expr:   "values() == ['test', 'example', 'sample', 'other']",
+			values: []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:   "list element mismatch",
+			expr:   "values() == ['test', 'sample', 'example']",
+			values: []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			// CEL lists only compare equal to other lists, so the iterable
+			// has to be on the left.
+			name:   "list on the left",
+			expr:   "['test', 'example', 'sample'] == values()",
+			values: []string{"test", "example", "sample"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:   "map",
+			expr:   "values() == {'test': 1}",
+			values: []string{"test"},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromSeq(slices.Values(test.values), func(v string) ref.Val {
+								return types.String(v)
+							})
+						}),
+					),
+				),
+				cel.Function(
+					"other",
+					cel.Overload(
+						"test_other",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromSeq(slices.Values(test.other), func(v string) ref.Val {
+								return types.String(v)
+							})
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestEqualIterable(t *testing.T) {
+	values := []string{"test", "example", "sample"}
+
+	t.Run("list view", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil)
+		other := celiter.FromSeq(slices.Values(values), nil).List()
+		must.Eq[ref.Val](t, types.True, val.Equal(other))
+	})
+
+	t.Run("known size mismatch", func(t *testing.T) {
+		val := celiter.FromSlice(values, nil)
+		other := types.NewStringList(types.DefaultTypeAdapter, values[:2])
+		must.Eq[ref.Val](t, types.False, val.Equal(other))
+
+		// The size mismatch is found without consuming the value.
+		size, _ := val.SizeHint()
+		must.Eq(t, size, 3)
+	})
+}
+
+func TestConvertToType(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "type expression",
+			expr: "type(values())",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq[ref.Val](t, val, celiter.Type)
+			},
+		},
+		{
+			name: "list equality expression",
+			expr: "list(values()) == ['test', 'example', 'sample']",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list index expression",
+			expr: "list(values())[2] == 'sample'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list concatenation expression",
+			expr: "size(list(values()) + ['extra']) == 4",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromSeq(
+								slices.Values([]string{"test", "example", "sample"}),
+								func(v string) ref.Val {
+									return types.String(v)
+								},
+							)
+						}),
+					),
+				),
+				cel.Function(
+					"list",
+					cel.Overload(
+						"test_list",
+						[]*cel.Type{celiter.Type},
+						cel.ListType(cel.DynType),
+						decls.UnaryBinding(func(val ref.Val) ref.Val {
+							return val.ConvertToType(types.ListType)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("unsupported type", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test"}), nil)
+		must.True(t, types.IsError(val.ConvertToType(types.IntType)))
+	})
+}
+
+func TestString(t *testing.T) {
+	t.Run("preview", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq(t, val.String(), "celiter[test, example, sample]")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{}), nil)
+		must.Eq(t, val.String(), "celiter[]")
+	})
+
+	t.Run("truncated infinite sequence", func(t *testing.T) {
+		var naturals iter.Seq[int] = func(yield func(int) bool) {
+			for i := 0; ; i++ {
+				if !yield(i) {
+					return
+				}
+			}
+		}
+
+		val := celiter.FromSeq(naturals, nil)
+		must.Eq(t, fmt.Sprintf("%v", val), "celiter[0, 1, 2, 3, 4, 5, 6, 7, 8, 9, ...]")
+	})
+
+	t.Run("string conversion", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq[ref.Val](t, val.ConvertToType(types.StringType), types.String("celiter[test, example, sample]"))
+	})
+
+	t.Run("slice not consumed", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"test", "example", "sample"}, nil)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("test"))
+
+		must.Eq(t, val.String(), "celiter[example, sample]")
+		must.Eq(t, val.String(), "celiter[example, sample]")
+
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"example", "sample"})
+	})
+
+	t.Run("sequence not consumed", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}), nil)
+		must.Eq(t, val.String(), "celiter[0, 1, 2, 3, 4, 5, 6, 7, 8, 9, ...]")
+		must.Eq(t, val.String(), "celiter[0, 1, 2, 3, 4, 5, 6, 7, 8, 9, ...]")
+
+		must.Eq(t, collectInts(val), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14})
+	})
+
+	t.Run("peeked", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		peek, ok := val.Peek()
+		must.True(t, ok)
+		must.Eq[ref.Val](t, peek, types.String("test"))
+
+		must.Eq(t, val.String(), "celiter[test, example, sample]")
+
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"test", "example", "sample"})
+	})
+
+	t.Run("reset after preview", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq(t, val.String(), "celiter[test, example, sample]")
+		must.NoError(t, val.Reset())
+
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"test", "example", "sample"})
+	})
+}
+
+func TestSeq2(t *testing.T) {
+	values := map[string]int{"test": 1, "example": 2, "sample": 3}
+
+	env, err := cel.NewEnv(
+		cel.Function(
+			"values",
+			cel.Overload(
+				"test_values",
+				[]*cel.Type{},
+				celiter.Type,
+				decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+					return celiter.FromSeq2(maps.All(values), nil)
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	for expr, check := range map[string]func(t *testing.T, val ref.Val, err error){
+		"values().exists(p, p[0] == 'example' && p[1] == 2)": func(t *testing.T, val ref.Val, err error) {
+			must.NoError(t, err)
+			must.Eq(t, fmt.Sprintf("%v", val), "true")
+		},
+		"values()": func(t *testing.T, val ref.Val, err error) {
+			must.NoError(t, err)
+			must.Eq(t, maps.Collect(celiter.AsSeq2[string, int64](val, nil)), map[string]int64{
+				"test":    1,
+				"example": 2,
+				"sample":  3,
+			})
+		},
+	} {
+		t.Run(expr, func(t *testing.T) {
+			ast, issues := env.Compile(expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			check(t, val, err)
+		})
+	}
+}
+
+func TestAsSeqError(t *testing.T) {
+	errSentinel := errors.New("sentinel")
+
+	tests := []struct {
+		name    string
+		hasNext celiter.HasNext
+		next    celiter.Next[string]
+	}{
+		{
+			name: "has next error",
+			hasNext: func() func() (bool, error) {
+				calls := 0
+				return func() (bool, error) {
+					calls++
+					if calls > 2 {
+						return false, errSentinel
+					}
+					return true, nil
+				}
+			}(),
+			next: func() func() (string, error) {
+				values := []string{"test", "example", "sample"}
+				index := 0
+				return func() (string, error) {
+					val := values[index]
+					index++
+					return val, nil
+				}
+			}(),
+		},
+		{
+			name: "next error",
+			hasNext: func() (bool, error) {
+				return true, nil
+			},
+			next: func() func() (string, error) {
+				values := []string{"test", "example"}
+				index := 0
+				return func() (string, error) {
+					if index >= len(values) {
+						return "", errSentinel
+					}
+					val := values[index]
+					index++
+					return val, nil
+				}
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			val := celiter.New(test.hasNext, test.next, func(s string) ref.Val {
+				return types.String(s)
+			})
+
+			seq := celiter.AsSeq(val, func(v ref.Val) string {
+				return v.Value().(string)
+			})
+
+			must.Eq(t, slices.Collect(seq), []string{"test", "example"})
+		})
+	}
+}
+
+func TestAsSeqE(t *testing.T) {
+	errBadValue := errors.New("bad value")
+
+	convert := func(v ref.Val) (string, error) {
+		s := v.Value().(string)
+		if s == "example" {
+			return "", errBadValue
+		}
+		return s, nil
+	}
+
+	t.Run("conversion error", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+
+		var (
+			got  []string
+			errs []error
+		)
+		for s, err := range celiter.AsSeqE(val, convert) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			got = append(got, s)
+		}
+
+		must.Eq(t, got, []string{"test", "sample"})
+		must.SliceLen(t, 1, errs)
+		must.ErrorIs(t, errs[0], errBadValue)
+	})
+
+	t.Run("iteration error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		calls := 0
+		val := celiter.New(
+			func() (bool, error) {
+				calls++
+				if calls > 1 {
+					return false, errSentinel
+				}
+				return true, nil
+			},
+			func() (string, error) {
+				return "test", nil
+			},
+			nil,
+		)
+
+		var (
+			got  []string
+			errs []error
+		)
+		for s, err := range celiter.AsSeqE[string](val, nil) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			got = append(got, s)
+		}
+
+		must.Eq(t, got, []string{"test"})
+		must.SliceLen(t, 1, errs)
+		must.ErrorIs(t, errs[0], errSentinel)
+	})
+
+	t.Run("not iterable", func(t *testing.T) {
+		for _, err := range celiter.AsSeqE[string](types.String("test"), nil) {
+			must.ErrorContains(t, err, "not an iterator")
+		}
+	})
+}
+
+func TestAsSeqOf(t *testing.T) {
+	t.Run("strings", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq(t, slices.Collect(celiter.AsSeqOf[string](val)), []string{"test", "example", "sample"})
+	})
+
+	t.Run("numeric conversion", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil)
+		must.Eq(t, slices.Collect(celiter.AsSeqOf[int32](val)), []int32{1, 2, 3})
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]any{"test", 1, "sample"}), nil)
+		must.Eq(t, slices.Collect(celiter.AsSeqOf[string](val)), []string{"test"})
+	})
+
+	t.Run("not iterable", func(t *testing.T) {
+		must.SliceEmpty(t, slices.Collect(celiter.AsSeqOf[string](types.String("test"))))
+	})
+}
+
+func TestClose(t *testing.T) {
+	var cleanedUp bool
+
+	var seq iter.Seq[string] = func(yield func(string) bool) {
+		defer func() {
+			cleanedUp = true
+		}()
+
+		for _, v := range []string{"test", "example", "sample"} {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+
+	val := celiter.FromSeq(seq, func(v string) ref.Val {
+		return types.String(v)
+	})
+
+	env, err := cel.NewEnv(
+		cel.Function(
+			"values",
+			cel.Overload(
+				"test_values",
+				[]*cel.Type{},
+				celiter.Type,
+				decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+					return val
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile("values().exists(x, x == 'test')")
+	if issues != nil {
+		t.Fatalf("failed to compile CEL expression: %v", issues)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{})
+	must.NoError(t, err)
+	must.Eq(t, fmt.Sprintf("%v", out), "true")
+	must.False(t, cleanedUp)
+
+	must.NoError(t, val.Close())
+	must.True(t, cleanedUp)
+	must.Eq[ref.Val](t, val.HasNext(), types.False)
+
+	must.NoError(t, celiter.New[string](nil, nil, nil).Close())
+}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var count int
+	var naturals iter.Seq[int] = func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			count++
+			if count == 3 {
+				cancel()
+			}
+			if !yield(i) {
+				return
+			}
+		}
+	}
+
+	env, err := cel.NewEnv(
+		cel.Function(
+			"values",
+			cel.Overload(
+				"test_values",
+				[]*cel.Type{},
+				celiter.Type,
+				decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+					return celiter.FromSeq(
+						naturals,
+						func(v int) ref.Val {
+							return types.Int(v)
+						},
+						celiter.WithContext(ctx),
+					)
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile("size(values())")
+	if issues != nil {
+		t.Fatalf("failed to compile CEL expression: %v", issues)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	_, _, err = prg.Eval(map[string]any{})
+	must.ErrorIs(t, err, context.Canceled)
+	must.Eq(t, count, 3)
+}
+
+func TestCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		opts  []celiter.Option
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "out of order index expression",
+			expr: "values()[2] == 'sample' && values()[0] == 'test' && values()[1] == 'example'",
+			opts: []celiter.Option{celiter.WithCache()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "repeated index expression",
+			expr: "values()[1] == values()[1]",
+			opts: []celiter.Option{celiter.WithCache()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "repeated contains expression",
+			expr: "'example' in values() && 'example' in values()",
+			opts: []celiter.Option{celiter.WithCache()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "contains after drain expression",
+			expr: "!('missing' in values()) && 'test' in values()",
+			opts: []celiter.Option{celiter.WithCache()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "repeated contains expression without cache",
+			expr: "'example' in values() && 'example' in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name: "out of order index expression without cache",
+			expr: "values()[2] == 'sample' && values()[0] == 'test'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "index already passed")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valuesIterable := celiter.FromSeq(
+				slices.Values([]string{"test", "example", "sample"}),
+				func(v string) ref.Val {
+					return types.String(v)
+				},
+				test.opts...,
+			)
+
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return valuesIterable
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestNegativeIndex(t *testing.T) {
+	var naturals iter.Seq[int] = func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		seq   iter.Seq[int]
+		opts  []celiter.Option
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "last element",
+			expr: "values()[-1] == 3",
+			seq:  slices.Values([]int{1, 2, 3}),
+			opts: []celiter.Option{celiter.WithNegativeIndex()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "second to last element",
+			expr: "values()[-2] == 2",
+			seq:  slices.Values([]int{1, 2, 3}),
+			opts: []celiter.Option{celiter.WithNegativeIndex()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "mixed indexes",
+			expr: "values()[1] == 2 && values()[-1] == 3 && values()[-3] == 1",
+			seq:  slices.Values([]int{1, 2, 3}),
+			opts: []celiter.Option{celiter.WithNegativeIndex()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "out of bounds",
+			expr: "values()[-4] == 1",
+			seq:  slices.Values([]int{1, 2, 3}),
+			opts: []celiter.Option{celiter.WithNegativeIndex()},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "index out of bounds")
+			},
+		},
+		{
+			name: "without option",
+			expr: "values()[-1] == 3",
+			seq:  slices.Values([]int{1, 2, 3}),
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "index cannot be negative")
+			},
+		},
+		{
+			name: "infinite sequence",
+			expr: "values()[-1] == 3",
+			seq:  naturals,
+			opts: []celiter.Option{celiter.WithNegativeIndex(), celiter.WithSizeLimit(100)},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "size exceeded maximum of 100")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valuesIterable := celiter.FromSeq(
+				test.seq,
+				func(v int) ref.Val {
+					return types.Int(v)
+				},
+				test.opts...,
+			)
+
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return valuesIterable
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	t.Run("peek then next", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+
+		peeked, ok := val.Peek()
+		must.True(t, ok)
+		must.Eq[ref.Val](t, peeked, types.String("test"))
+
+		peeked, ok = val.Peek()
+		must.True(t, ok)
+		must.Eq[ref.Val](t, peeked, types.String("test"))
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("test"))
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.String("test"))
+
+		peeked, ok = val.Peek()
+		must.True(t, ok)
+		must.Eq[ref.Val](t, peeked, types.String("example"))
+		must.Eq[ref.Val](t, val.Get(types.Int(1)), types.String("example"))
+		must.Eq[ref.Val](t, val.Get(types.Int(2)), types.String("sample"))
+
+		_, ok = val.Peek()
+		must.False(t, ok)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{}), nil)
+
+		peeked, ok := val.Peek()
+		must.False(t, ok)
+		must.Eq[ref.Val](t, peeked, types.False)
+	})
+}
+
+func TestIndex(t *testing.T) {
+	val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+	must.Eq(t, val.Index(), -1)
+
+	_, ok := val.Peek()
+	must.True(t, ok)
+	must.Eq(t, val.Index(), -1)
+
+	for i := range 3 {
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		val.Next()
+		must.Eq(t, val.Index(), i)
+	}
+
+	must.Eq[ref.Val](t, val.HasNext(), types.False)
+	must.Eq(t, val.Index(), 2)
+
+	must.NoError(t, val.Reset())
+	must.Eq(t, val.Index(), -1)
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("exhausted", func(t *testing.T) {
+		var seen []int
+		val := celiter.FromSeq(func(yield func(int) bool) {
+			for i := range 3 {
+				seen = append(seen, i)
+				if !yield(i) {
+					return
+				}
+			}
+		}, nil)
+
+		must.NoError(t, val.Drain())
+		must.Eq(t, seen, []int{0, 1, 2})
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("mid-stream error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		var (
+			values      = []string{"test", "example", "sample"}
+			valuesIndex = 0
+		)
+
+		val := celiter.New(
+			func() (bool, error) {
+				return valuesIndex < len(values), nil
+			},
+			func() (string, error) {
+				if valuesIndex == 1 {
+					return "", errSentinel
+				}
+				val := values[valuesIndex]
+				valuesIndex++
+				return val, nil
+			},
+			nil,
+		)
+
+		err := val.Drain()
+		must.ErrorIs(t, err, errSentinel)
+		must.ErrorContains(t, err, "error getting next element")
+		must.Eq(t, val.Index(), 0)
+	})
+}
+
+func TestSeek(t *testing.T) {
+	t.Run("forward", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"a", "b", "c", "d", "e"}), nil)
+
+		must.NoError(t, val.Seek(2))
+		must.Eq(t, val.Index(), 1)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("c"))
+
+		must.NoError(t, val.Seek(4))
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("e"))
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("random access", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"a", "b", "c", "d", "e"}, nil)
+
+		must.NoError(t, val.Seek(3))
+		must.Eq(t, val.Index(), 2)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("d"))
+	})
+
+	t.Run("start", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"a", "b"}, nil)
+
+		must.NoError(t, val.Seek(0))
+		must.Eq(t, val.Index(), -1)
+		must.Nil(t, val.Value())
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("a"))
+	})
+
+	t.Run("after peek", func(t *testing.T) {
+		for name, val := range map[string]*celiter.Value[string]{
+			"seq":   celiter.FromSeq(slices.Values([]string{"a", "b", "c", "d"}), nil),
+			"slice": celiter.FromSlice([]string{"a", "b", "c", "d"}, nil),
+		} {
+			t.Run(name, func(t *testing.T) {
+				peek, ok := val.Peek()
+				must.True(t, ok)
+				must.Eq[ref.Val](t, peek, types.String("a"))
+
+				must.NoError(t, val.Seek(2))
+				must.Eq[ref.Val](t, val.HasNext(), types.True)
+				must.Eq[ref.Val](t, val.Next(), types.String("c"))
+			})
+		}
+	})
+
+	t.Run("backward", func(t *testing.T) {
+		for name, val := range map[string]*celiter.Value[string]{
+			"seq":   celiter.FromSeq(slices.Values([]string{"a", "b", "c"}), nil),
+			"slice": celiter.FromSlice([]string{"a", "b", "c"}, nil),
+		} {
+			t.Run(name, func(t *testing.T) {
+				must.NoError(t, val.Seek(2))
+				must.Eq[ref.Val](t, val.HasNext(), types.True)
+				must.Eq[ref.Val](t, val.Next(), types.String("c"))
+
+				must.ErrorContains(t, val.Seek(1), "unable to seek to index 1: already at index 2")
+				must.ErrorContains(t, val.Seek(2), "already at index 2")
+				must.Eq(t, val.Index(), 2)
+			})
+		}
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		for name, val := range map[string]*celiter.Value[string]{
+			"seq":   celiter.FromSeq(slices.Values([]string{"a", "b", "c"}), nil),
+			"slice": celiter.FromSlice([]string{"a", "b", "c"}, nil),
+		} {
+			t.Run(name, func(t *testing.T) {
+				must.ErrorContains(t, val.Seek(5), "unable to seek to index 5: out of bounds")
+			})
+		}
+	})
+}
+
+func TestWithConverter(t *testing.T) {
+	wrap := func(s string) ref.Val {
+		return types.String("<" + s + ">")
+	}
+
+	t.Run("next", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		wrapped := val.WithConverter(wrap)
+
+		must.Eq[ref.Val](t, wrapped.HasNext(), types.True)
+		must.Eq[ref.Val](t, wrapped.Next(), types.String("<test>"))
+		must.Eq[ref.Val](t, wrapped.Get(types.Int(2)), types.String("<sample>"))
+	})
+
+	t.Run("size", func(t *testing.T) {
+		wrapped := celiter.FromSlice([]string{"test", "example", "sample"}, nil).WithConverter(wrap)
+
+		must.Eq[ref.Val](t, wrapped.Size(), types.Int(3))
+		must.Eq[ref.Val](t, wrapped.Contains(types.String("<example>")), types.True)
+	})
+
+	t.Run("underlying sequence", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		wrapped := val.WithConverter(wrap)
+
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](wrapped, nil)), []string{"<test>", "<example>", "<sample>"})
+
+		must.NoError(t, wrapped.Reset())
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), []string{"test", "example", "sample"})
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		wrapped := celiter.Repeat("test", -1, nil, celiter.WithSizeLimit(10)).WithConverter(wrap)
+
+		size := wrapped.Size()
+		must.True(t, types.IsError(size))
+		must.StrContains(t, fmt.Sprintf("%v", size), "size exceeded maximum of 10")
+	})
+
+	t.Run("random access", func(t *testing.T) {
+		wrapped := celiter.FromSlice([]string{"test", "example", "sample"}, nil).WithConverter(wrap)
+
+		must.Eq[ref.Val](t, wrapped.Contains(types.String("<sample>")), types.True)
+		must.Eq(t, wrapped.Index(), -1)
+		must.Eq[ref.Val](t, wrapped.Get(types.Int(1)), types.String("<example>"))
+
+		must.Eq[ref.Val](t, wrapped.HasNext(), types.True)
+		must.Eq[ref.Val](t, wrapped.Next(), types.String("<test>"))
+		must.Eq(t, wrapped.Index(), 0)
+
+		it := wrapped.Iterator()
+		must.Eq[ref.Val](t, it.HasNext(), types.True)
+		must.Eq[ref.Val](t, it.Next(), types.String("<test>"))
+	})
+
+	t.Run("map key", func(t *testing.T) {
+		wrapped := celiter.FromMap(map[string]string{"a": "test", "b": "example"}, nil).WithConverter(wrap)
+
+		must.Eq[ref.Val](t, wrapped.Get(types.String("b")), types.String("<example>"))
+		must.Eq[ref.Val](t, wrapped.Get(types.Int(0)), types.String("<test>"))
+	})
+
+	t.Run("cache and hooks", func(t *testing.T) {
+		var indexes []int
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil, celiter.WithCache(), celiter.WithOnNext(func(index int, _ ref.Val) {
+			indexes = append(indexes, index)
+		}))
+		wrapped := val.WithConverter(wrap)
+
+		must.Eq[ref.Val](t, wrapped.Get(types.Int(2)), types.String("<sample>"))
+		must.Eq[ref.Val](t, wrapped.Get(types.Int(0)), types.String("<test>"))
+		must.Eq(t, indexes, []int{0, 1, 2})
+	})
+
+	t.Run("cached clone", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil, celiter.WithCache())
+		clone, err := val.Clone()
+		must.NoError(t, err)
+
+		wrapped := clone.WithConverter(wrap)
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](wrapped, nil)), []string{"<test>", "<example>", "<sample>"})
+
+		must.NoError(t, wrapped.Reset())
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](wrapped, nil)), []string{"<test>", "<example>", "<sample>"})
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		wrapped := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil).WithConverter(wrap)
+
+		clone, err := wrapped.Clone()
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, clone.HasNext(), types.True)
+		must.Eq[ref.Val](t, clone.Next(), types.String("<test>"))
+	})
+}
+
+func TestPeekable(t *testing.T) {
+	// parity reads the next run of elements with the same parity, using the
+	// lookahead to stop before the first element of the following run.
+	parity := func(p celiter.Peekable) []int {
+		var run []int
+		for {
+			peeked, ok := p.Peek()
+			if !ok {
+				return run
+			}
+			n := int(peeked.(types.Int))
+			if len(run) > 0 && n%2 != run[0]%2 {
+				return run
+			}
+			p.Next()
+			run = append(run, n)
+		}
+	}
+
+	var p celiter.Peekable = celiter.FromSeq(fibonacciSeq, fibonacciConvert)
+
+	var runs [][]int
+	for range 5 {
+		runs = append(runs, parity(p))
+	}
+	must.Eq(t, runs, [][]int{{0}, {1, 1}, {2}, {3, 5}, {8}})
+
+	must.Eq[ref.Val](t, p.HasNext(), types.True)
+	must.Eq[ref.Val](t, p.Next(), types.Int(13))
+}
+
+func TestAsSlice(t *testing.T) {
+	t.Run("sample values", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), func(v string) ref.Val {
+			return types.String(v)
+		})
+
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"test", "example", "sample"})
+	})
+
+	t.Run("mid-stream error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		var (
+			values      = []string{"test", "example", "sample"}
+			valuesIndex = 0
+		)
+
+		val := celiter.New(
+			func() (bool, error) {
+				return valuesIndex < len(values), nil
+			},
+			func() (string, error) {
+				if valuesIndex == 2 {
+					return "", errSentinel
+				}
+				val := values[valuesIndex]
+				valuesIndex++
+				return val, nil
+			},
+			func(s string) ref.Val {
+				return types.String(s)
+			},
+		)
+
+		partial, err := celiter.AsSlice(val, func(v ref.Val) string {
+			return v.Value().(string)
+		})
+		must.ErrorIs(t, err, errSentinel)
+		must.Eq(t, partial, []string{"test", "example"})
+	})
+
+	t.Run("not iterable", func(t *testing.T) {
+		_, err := celiter.AsSlice[string](types.String("test"), nil)
+		must.Error(t, err)
+	})
+}
+
+func TestAsChannel(t *testing.T) {
+	t.Run("cancel", func(t *testing.T) {
+		val := celiter.FromSeq(fibonacciSeq, fibonacciConvert)
+
+		ch, cancel := celiter.AsChannel(val, func(v ref.Val) int {
+			return int(v.(types.Int))
+		}, 2)
+
+		var values []int
+		for range 3 {
+			values = append(values, <-ch)
+		}
+		cancel()
+		cancel()
+
+		must.Eq(t, values, []int{0, 1, 1})
+
+		// The goroutine has returned, so the value can be used again.
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		ch, cancel := celiter.AsChannel[string](celiter.FromSlice([]string{"test", "example", "sample"}, nil), nil, 0)
+		defer cancel()
+
+		var values []string
+		for v := range ch {
+			values = append(values, v)
+		}
+		must.Eq(t, values, []string{"test", "example", "sample"})
+	})
+}
+func TestToList(t *testing.T) {
+	val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), func(v string) ref.Val {
+		return types.String(v)
+	})
+
+	list := val.ToList()
+	must.Eq[ref.Type](t, list.Type(), types.ListType)
+	must.Eq[ref.Val](t, list.Equal(types.NewStringList(types.DefaultTypeAdapter, []string{"test", "example", "sample"})), types.True)
+	must.Eq[ref.Val](t, val.HasNext(), types.False)
+}
+
+type point struct {
+	X, Y int
+}
+
+type pointAdapter struct{}
+
+func (pointAdapter) NativeToValue(value any) ref.Val {
+	if p, ok := value.(point); ok {
+		return types.String(fmt.Sprintf("(%d, %d)", p.X, p.Y))
+	}
+	return types.DefaultTypeAdapter.NativeToValue(value)
+}
+
+func TestAdapter(t *testing.T) {
+	points := []point{{1, 2}, {3, 4}}
+
+	t.Run("default adapter", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(points), nil)
+		must.True(t, types.IsError(val.Get(types.Int(0))))
+	})
+
+	t.Run("custom adapter", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(points), nil, celiter.WithAdapter(pointAdapter{}))
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.String("(1, 2)"))
+		must.Eq[ref.Val](t, val.Contains(types.String("(3, 4)")), types.True)
+	})
+
+	t.Run("in expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Function(
+				"values",
+				cel.Overload(
+					"test_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.FromSeq(slices.Values(points), nil, celiter.WithAdapter(pointAdapter{}))
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("'(3, 4)' in values()")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+	})
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		other  []int
+		check  func(t *testing.T, val ref.Val)
+	}{
+		{
+			name:   "less",
+			values: []int{1, 2, 3},
+			other:  []int{1, 2, 4},
+			check: func(t *testing.T, val ref.Val) {
+				must.Eq[ref.Val](t, val, types.IntNegOne)
+			},
+		},
+		{
+			name:   "greater",
+			values: []int{1, 2, 4},
+			other:  []int{1, 2, 3},
+			check: func(t *testing.T, val ref.Val) {
+				must.Eq[ref.Val](t, val, types.IntOne)
+			},
+		},
+		{
+			name:   "equal",
+			values: []int{1, 2, 3},
+			other:  []int{1, 2, 3},
+			check: func(t *testing.T, val ref.Val) {
+				must.Eq[ref.Val](t, val, types.IntZero)
+			},
+		},
+		{
+			name:   "prefix",
+			values: []int{1, 2},
+			other:  []int{1, 2, 3},
+			check: func(t *testing.T, val ref.Val) {
+				must.Eq[ref.Val](t, val, types.IntNegOne)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			val := celiter.FromSeq(slices.Values(test.values), nil)
+			other := celiter.FromSeq(slices.Values(test.other), nil)
+			test.check(t, val.Compare(other))
+		})
+	}
+
+	t.Run("itself", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]int64{1, 2, 3}), nil)
+		must.Eq[ref.Val](t, val.Compare(val), types.IntZero)
+	})
+
+	t.Run("incomparable elements", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]any{[]int{1}}), nil)
+		other := celiter.FromSeq(slices.Values([]any{[]int{1}}), nil)
+		must.True(t, types.IsError(val.Compare(other)))
+	})
+
+	t.Run("less than expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Function(
+				"values",
+				cel.Overload(
+					"test_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil)
+					}),
+				),
+			),
+			cel.Function(
+				"other",
+				cel.Overload(
+					"test_other",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.FromSeq(slices.Values([]int{1, 2, 4}), nil)
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values() < other()")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+	})
+}
+
+func TestMutex(t *testing.T) {
+	const n = 1000
+
+	newValue := func() *celiter.Value[int] {
+		i := 0
+		return celiter.New(
+			func() (bool, error) {
+				return i < n, nil
+			},
+			func() (int, error) {
+				if i >= n {
+					return 0, fmt.Errorf("no next element")
+				}
+				i++
+				return i, nil
+			},
+			func(v int) ref.Val {
+				return types.Int(v)
+			},
+			celiter.WithMutex(),
+		)
+	}
+
+	t.Run("concurrent next", func(t *testing.T) {
+		val := newValue()
+
+		var (
+			wg      sync.WaitGroup
+			results = make([][]int, 8)
+		)
+		for g := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for val.HasNext() == types.True {
+					// Another goroutine may take the last element between
+					// the calls to HasNext and Next.
+					next := val.Next()
+					if types.IsError(next) {
+						continue
+					}
+					results[g] = append(results[g], int(next.(types.Int)))
+				}
+			}()
+		}
+		wg.Wait()
+
+		var got []int
+		for _, result := range results {
+			got = append(got, result...)
+		}
+		slices.Sort(got)
+
+		want := make([]int, n)
+		for i := range want {
+			want[i] = i + 1
+		}
+		must.Eq(t, want, got)
+	})
+
+	t.Run("concurrent peek", func(t *testing.T) {
+		val := newValue()
+
+		var (
+			wg      sync.WaitGroup
+			results = make([][]int, 8)
+		)
+		for g := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if g%2 == 0 {
+						if _, ok := val.Peek(); !ok {
+							return
+						}
+					} else if val.IsEmpty() == types.True {
+						return
+					}
+					if val.HasNext() != types.True {
+						return
+					}
+					// Another goroutine may take the peeked element between
+					// the calls to Peek and Next.
+					next := val.Next()
+					if types.IsError(next) {
+						continue
+					}
+					results[g] = append(results[g], int(next.(types.Int)))
+				}
+			}()
+		}
+		wg.Wait()
+
+		var got []int
+		for _, result := range results {
+			got = append(got, result...)
+		}
+		slices.Sort(got)
+
+		want := make([]int, n)
+		for i := range want {
+			want[i] = i + 1
+		}
+		must.Eq(t, want, got)
+	})
+
+	t.Run("concurrent size", func(t *testing.T) {
+		val := newValue()
+
+		var (
+			wg    sync.WaitGroup
+			sizes = make([]int64, 4)
+		)
+		for g := range sizes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sizes[g] = int64(val.Size().(types.Int))
+			}()
+		}
+		wg.Wait()
+
+		for _, size := range sizes {
+			must.Eq(t, int64(n), size)
+		}
+	})
+}
+
+func TestRecover(t *testing.T) {
+	panicConvert := func(v any) ref.Val {
+		return types.String(v.(string))
+	}
+
+	t.Run("convert panic expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Function(
+				"values",
+				cel.Overload(
+					"test_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.FromSeq(slices.Values([]any{1, 2, 3}), panicConvert)
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values().exists(v, v == 'test')")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		_, _, err = prg.Eval(map[string]any{})
+		must.ErrorContains(t, err, "panic getting next element")
+	})
+
+	t.Run("next panic", func(t *testing.T) {
+		val := celiter.New(
+			func() (bool, error) {
+				return true, nil
+			},
+			func() (int, error) {
+				panic("boom")
+			},
+			nil,
+		)
+
+		next := val.Next()
+		must.True(t, types.IsError(next))
+		must.StrContains(t, fmt.Sprintf("%v", next), "boom")
+	})
+
+	t.Run("without recover", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]any{1}), panicConvert, celiter.WithoutRecover())
+
+		defer func() {
+			must.NotNil(t, recover())
+		}()
+		val.Next()
+		t.Fatal("expected Next to panic")
+	})
+}
+
+func TestContainsNumeric(t *testing.T) {
+	tests := []struct {
+		name   string
+		expr   string
+		values func() ref.Val
+		want   string
+	}{
+		{
+			name: "double in ints",
+			expr: "1.0 in values()",
+			values: func() ref.Val {
+				return celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil)
+			},
+			want: "true",
+		},
+		{
+			name: "fractional double in ints",
+			expr: "1.5 in values()",
+			values: func() ref.Val {
+				return celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil)
+			},
+			want: "false",
+		},
+		{
+			name: "uint in ints",
+			expr: "3u in values()",
+			values: func() ref.Val {
+				return celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil)
+			},
+			want: "true",
+		},
+		{
+			name: "int in doubles",
+			expr: "2 in values()",
+			values: func() ref.Val {
+				return celiter.FromSeq(slices.Values([]float64{1.5, 2.0}), nil)
+			},
+			want: "true",
+		},
+		{
+			name: "double in random access ints",
+			expr: "2.0 in values() && !(2.5 in values())",
+			values: func() ref.Val {
+				return celiter.FromSlice([]int{1, 2, 3}, nil)
+			},
+			want: "true",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return test.values()
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			must.NoError(t, err)
+			must.Eq(t, fmt.Sprintf("%v", val), test.want)
+		})
+	}
+}
+
+func TestContainsComparator(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		opts []celiter.Option
+		want string
+	}{
+		{
+			name: "case-insensitive match",
+			expr: "'TEST' in values()",
+			opts: []celiter.Option{
+				celiter.WithContainsComparator(func(cur, target ref.Val) bool {
+					return strings.EqualFold(string(cur.(types.String)), string(target.(types.String)))
+				}),
+			},
+			want: "true",
+		},
+		{
+			name: "case-insensitive no match",
+			expr: "'OTHER' in values()",
+			opts: []celiter.Option{
+				celiter.WithContainsComparator(func(cur, target ref.Val) bool {
+					return strings.EqualFold(string(cur.(types.String)), string(target.(types.String)))
+				}),
+			},
+			want: "false",
+		},
+		{
+			name: "default equality",
+			expr: "'TEST' in values()",
+			want: "false",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromSeq(
+								slices.Values([]string{"test", "example", "sample"}),
+								func(v string) ref.Val {
+									return types.String(v)
+								},
+								test.opts...,
+							)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			must.NoError(t, err)
+			must.Eq(t, fmt.Sprintf("%v", val), test.want)
+		})
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	t.Run("empty slice", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{}), nil)
+		must.Eq[ref.Val](t, types.True, val.IsEmpty())
+	})
+
+	t.Run("non-empty slice", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq[ref.Val](t, types.False, val.IsEmpty())
+		must.Eq[ref.Val](t, types.String("test"), val.Next())
+	})
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.FromSeq(func(yield func(int) bool) {
+			for i := 0; ; i++ {
+				if !yield(i) {
+					return
+				}
+			}
+		}, nil)
+		must.Eq[ref.Val](t, types.False, val.IsEmpty())
+		must.Eq[ref.Val](t, types.Int(0), val.Next())
+	})
+
+	t.Run("repeated", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"a", "b", "c"}), nil)
+		must.Eq[ref.Val](t, types.False, val.IsEmpty())
+		must.Eq[ref.Val](t, types.False, val.IsEmpty())
+
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("a"), val.Next())
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("b"), val.Next())
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("c"), val.Next())
+		must.Eq[ref.Val](t, types.True, val.IsEmpty())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+		val := celiter.New[string](func() (bool, error) {
+			return false, errSentinel
+		}, nil, nil)
+
+		isEmpty := val.IsEmpty()
+		must.True(t, types.IsError(isEmpty))
+		must.ErrorIs(t, isEmpty.(*types.Err), errSentinel)
+	})
+}
+
+func TestClone(t *testing.T) {
+	next := func(v *celiter.Value[string]) ref.Val {
+		if hasNext := v.HasNext(); hasNext != types.True {
+			return hasNext
+		}
+		return v.Next()
+	}
+
+	t.Run("slice", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+		must.Eq[ref.Val](t, types.String("test"), next(val))
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+
+		must.Eq[ref.Val](t, types.String("example"), next(val))
+		must.Eq[ref.Val](t, types.String("sample"), next(val))
+		must.Eq[ref.Val](t, types.False, next(val))
+
+		must.Eq[any](t, "test", clone.Value())
+		must.Eq[ref.Val](t, types.String("example"), next(clone))
+		must.Eq[ref.Val](t, types.String("sample"), next(clone))
+		must.Eq[ref.Val](t, types.False, next(clone))
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil, celiter.WithCache())
+		must.Eq[ref.Val](t, types.String("example"), val.Get(types.Int(1)))
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, types.String("test"), clone.Get(types.Int(0)))
+		must.Eq[ref.Val](t, types.String("sample"), clone.Get(types.Int(2)))
+		must.Eq[ref.Val](t, types.String("sample"), val.Get(types.Int(2)))
+	})
+
+	t.Run("peeked", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]string{"test", "example"}), nil)
+		_, ok := val.Peek()
+		must.True(t, ok)
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, types.String("test"), clone.Next())
+		must.Eq[ref.Val](t, types.String("test"), val.Next())
+	})
+
+	t.Run("not cloneable", func(t *testing.T) {
+		val := celiter.New(nil, func() (int, error) { return 0, nil }, nil)
+		_, err := val.Clone()
+		must.ErrorContains(t, err, "source cannot be replayed")
+	})
+
+	t.Run("random access", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"test", "example", "sample"}, nil)
+		must.Eq[ref.Val](t, types.String("test"), next(val))
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, types.String("example"), next(clone))
+		must.Eq[ref.Val](t, types.String("example"), next(val))
+	})
+
+	t.Run("random access options", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"test", "example", "sample"}, nil, celiter.WithNegativeIndex(), celiter.WithSizeLimit(2), celiter.WithMutex())
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, types.String("sample"), clone.Get(types.Int(-1)))
+
+		size := clone.Size()
+		must.True(t, types.IsError(size))
+		must.StrContains(t, fmt.Sprintf("%v", size), "size exceeded maximum of 2")
+
+		// The copy keeps its own mutex, so it can be shared by goroutines.
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for clone.HasNext() == types.True {
+					clone.Next()
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("cache single-pass", func(t *testing.T) {
+		var (
+			values = []string{"test", "example", "sample"}
+			reads  int
+		)
+		val := celiter.New(
+			func() (bool, error) {
+				return reads < len(values), nil
+			},
+			func() (string, error) {
+				reads++
+				return values[reads-1], nil
+			},
+			nil,
+			celiter.WithCache(),
+		)
+		must.Eq[ref.Val](t, types.String("test"), next(val))
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+		must.Eq(t, clone.Index(), 0)
+		must.Eq[ref.Val](t, types.String("example"), next(clone))
+		must.Eq[ref.Val](t, types.String("sample"), next(clone))
+		must.Eq[ref.Val](t, types.False, next(clone))
+		must.Eq[ref.Val](t, types.String("test"), clone.Get(types.Int(0)))
+
+		must.Eq[ref.Val](t, types.String("example"), next(val))
+		must.Eq[ref.Val](t, types.String("sample"), next(val))
+		must.Eq[ref.Val](t, types.False, next(val))
+		must.Eq(t, reads, 3)
+	})
+
+	t.Run("map keys", func(t *testing.T) {
+		m := make(map[int]bool)
+		for i := range 50 {
+			m[i] = true
+		}
+
+		_, err := celiter.FromMapKeys(m, nil).Clone()
+		must.ErrorContains(t, err, "source cannot be replayed")
+
+		val := celiter.FromMapKeys(m, nil, celiter.WithCache())
+		must.NoError(t, val.Seek(5))
+
+		clone, err := val.Clone()
+		must.NoError(t, err)
+		must.Eq(t, collectInts(clone), collectInts(val))
+	})
+}
+
+func TestMaterialize(t *testing.T) {
+	values := []string{"test", "example", "sample"}
+
+	t.Run("out of order access", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil)
+		must.NoError(t, val.Materialize())
+
+		must.Eq[ref.Val](t, types.String("sample"), val.Get(types.Int(2)))
+		must.Eq[ref.Val](t, types.String("test"), val.Get(types.Int(0)))
+		must.Eq[ref.Val](t, types.String("example"), val.Get(types.Int(1)))
+		must.True(t, types.IsError(val.Get(types.Int(3))))
+		must.Eq[ref.Val](t, types.Int(3), val.Size())
+		must.Eq[ref.Val](t, types.True, val.Contains(types.String("test")))
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), values)
+		must.NoError(t, val.Reset())
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), values)
+	})
+
+	t.Run("after next", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil)
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("test"), val.Next())
+		must.NoError(t, val.Materialize())
+		must.Eq[ref.Val](t, types.Int(2), val.Size())
+		must.Eq[ref.Val](t, types.String("example"), val.Get(types.Int(0)))
+	})
+
+	t.Run("cached after get", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil, celiter.WithCache())
+		must.Eq[ref.Val](t, types.String("example"), val.Get(types.Int(1)))
+		must.NoError(t, val.Materialize())
+
+		must.Eq(t, val.Index(), 1)
+		must.Eq[ref.Val](t, types.String("test"), val.Get(types.Int(0)))
+		must.Eq[ref.Val](t, types.String("example"), val.Get(types.Int(1)))
+		must.Eq[ref.Val](t, types.String("sample"), val.Get(types.Int(2)))
+		must.Eq[ref.Val](t, types.Int(3), val.Size())
+
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("sample"), val.Next())
+		must.Eq[ref.Val](t, types.False, val.HasNext())
+	})
+
+	t.Run("cached after peek", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil, celiter.WithCache())
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("test"), val.Next())
+		peek, ok := val.Peek()
+		must.True(t, ok)
+		must.Eq[ref.Val](t, types.String("example"), peek)
+		must.NoError(t, val.Materialize())
+
+		must.Eq(t, val.Index(), 0)
+		must.Eq[ref.Val](t, types.Int(3), val.Size())
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("example"), val.Next())
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		val := celiter.FromSeq(fibonacciSeq, nil, celiter.WithSizeLimit(10))
+		must.ErrorContains(t, val.Materialize(), "size exceeded maximum of 10")
+	})
+
+	t.Run("expression", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), func(v string) ref.Val {
+			return types.String(v)
+		})
+		must.NoError(t, val.Materialize())
+
+		env, err := cel.NewEnv(
+			cel.Function(
+				"values",
+				cel.Overload(
+					"test_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return val
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values()[2] == 'sample' && values()[0] == 'test' && size(values()) == 3 && values().exists(x, x == 'example') && values().all(x, x != '')")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", out), "true")
+	})
+}
+
+func TestSizeAfterGet(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Function(
+			"values",
+			cel.Overload(
+				"test_values",
+				[]*cel.Type{},
+				celiter.Type,
+				decls.FunctionBinding(func() func(_ ...ref.Val) ref.Val {
+					val := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+					return func(_ ...ref.Val) ref.Val {
+						return val
+					}
+				}()),
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile("values()[1] == 'example' && size(values()) == 3")
+	if issues != nil {
+		t.Fatalf("failed to compile CEL expression: %v", issues)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	val, _, err := prg.Eval(map[string]any{})
+	must.NoError(t, err)
+	must.Eq(t, fmt.Sprintf("%v", val), "true")
+}
+
+func TestHooks(t *testing.T) {
+	t.Run("on next exists expression", func(t *testing.T) {
+		var indexes []int
+
+		env, err := cel.NewEnv(
+			cel.Function(
+				"values",
+				cel.Overload(
+					"test_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.FromSeq(
+							slices.Values([]string{"test", "example", "sample", "other", "last"}),
+							func(v string) ref.Val {
+								return types.String(v)
+							},
+							celiter.WithOnNext(func(index int, _ ref.Val) {
+								indexes = append(indexes, index)
+							}),
+						)
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values().exists(x, x == 'example')")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+		// The exists macro gets the element after the match before it checks
+		// whether to stop, and no elements are consumed after that.
+		must.Eq(t, indexes, []int{0, 1, 2})
+	})
+
+	t.Run("on error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		var errs []error
+		val := celiter.New(
+			func() (bool, error) {
+				return false, errSentinel
+			},
+			func() (string, error) {
+				return "", errSentinel
+			},
+			nil,
+			celiter.WithOnError(func(err error) {
+				errs = append(errs, err)
+			}),
+		)
+
+		must.True(t, types.IsError(val.HasNext()))
+		must.True(t, types.IsError(val.Next()))
+		must.SliceLen(t, 2, errs)
+		must.ErrorIs(t, errs[0], errSentinel)
+		must.ErrorIs(t, errs[1], errSentinel)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	const interval = 20 * time.Millisecond
+
+	t.Run("elapsed", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"test", "example", "sample"}, nil, celiter.WithRateLimit(interval))
+
+		start := time.Now()
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"test", "example", "sample"})
+		must.GreaterEq(t, 2*interval, time.Since(start))
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+
+		val := celiter.FromSlice([]string{"test", "example"}, nil, celiter.WithRateLimit(time.Hour), celiter.WithContext(ctx))
+
+		must.Eq[ref.Val](t, types.True, val.HasNext())
+		must.Eq[ref.Val](t, types.String("test"), val.Next())
+
+		hasNext := val.HasNext()
+		must.True(t, types.IsError(hasNext))
+		must.ErrorIs(t, hasNext.(*types.Err), context.DeadlineExceeded)
+	})
+
+	t.Run("sequence", func(t *testing.T) {
+		var pulls []time.Time
+		val := celiter.FromSeq(func(yield func(string) bool) {
+			for _, v := range []string{"test", "example", "sample"} {
+				pulls = append(pulls, time.Now())
+				if !yield(v) {
+					return
+				}
+			}
+		}, nil, celiter.WithRateLimit(interval))
+		defer val.Close()
+
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"test", "example", "sample"})
+
+		must.SliceLen(t, 3, pulls)
+		for i := 1; i < len(pulls); i++ {
+			must.GreaterEq(t, interval, pulls[i].Sub(pulls[i-1]))
+		}
+	})
+
+	t.Run("once per element", func(t *testing.T) {
+		val := celiter.FromSlice([]string{"test", "example", "sample"}, nil, celiter.WithRateLimit(interval))
+
+		// Only the first check doesn't wait, so reading three elements and
+		// checking for a fourth waits three times, not once more for each
+		// element when it is fetched.
+		start := time.Now()
+		values, err := celiter.AsSlice[string](val, nil)
+		must.NoError(t, err)
+		must.Eq(t, values, []string{"test", "example", "sample"})
+		must.Less(t, 5*interval, time.Since(start))
+	})
+}
+
+func TestAllMacro(t *testing.T) {
+	tests := []struct {
+		name   string
+		values func() *celiter.Value[string]
+		want   string
+	}{
+		{
+			name: "empty",
+			values: func() *celiter.Value[string] {
+				return celiter.New[string](nil, nil, nil)
+			},
+			want: "true",
+		},
+		{
+			name: "empty sequence",
+			values: func() *celiter.Value[string] {
+				return celiter.FromSeq(slices.Values([]string{}), nil)
+			},
+			want: "true",
+		},
+		{
+			name: "empty drained and reset",
+			values: func() *celiter.Value[string] {
+				val := celiter.FromSeq(slices.Values([]string{}), nil)
+				must.Eq[ref.Val](t, val.Size(), types.Int(0))
+				must.NoError(t, val.Reset())
+				return val
+			},
+			want: "true",
+		},
+		{
+			name: "all match",
+			values: func() *celiter.Value[string] {
+				return celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil)
+			},
+			want: "true",
+		},
+		{
+			name: "one mismatch",
+			values: func() *celiter.Value[string] {
+				return celiter.FromSeq(slices.Values([]string{"test", "", "sample"}), nil)
+			},
+			want: "false",
+		},
+		{
+			name: "one mismatch drained and reset",
+			values: func() *celiter.Value[string] {
+				val := celiter.FromSeq(slices.Values([]string{"test", "", "sample"}), nil)
+				must.Eq[ref.Val](t, val.Size(), types.Int(3))
+				must.NoError(t, val.Reset())
+				return val
+			},
+			want: "false",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := test.values()
+
+			env, err := cel.NewEnv(
+				celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+					return values
+				}),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile("values().all(x, x != '')")
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			must.NoError(t, err)
+			must.Eq(t, fmt.Sprintf("%v", val), test.want)
+		})
+	}
+}
+
+func TestResetOnIterate(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		opts []celiter.Option
+		want string
+	}{
+		{
+			name: "exists and all",
+			expr: "values().exists(x, x == 'sample') && values().all(x, x != '')",
+			opts: []celiter.Option{celiter.WithResetOnIterate()},
+			want: "true",
+		},
+		{
+			name: "exists twice",
+			expr: "values().exists(x, x == 'test') && values().exists(x, x == 'test')",
+			opts: []celiter.Option{celiter.WithResetOnIterate()},
+			want: "true",
+		},
+		{
+			name: "exists after size",
+			expr: "size(values()) == 3 && values().exists(x, x == 'test')",
+			opts: []celiter.Option{celiter.WithResetOnIterate()},
+			want: "true",
+		},
+		{
+			name: "exists twice without reset",
+			expr: "values().exists(x, x == 'test') && values().exists(x, x == 'test')",
+			want: "false",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil, test.opts...)
+
+			env, err := cel.NewEnv(
+				celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+					return values
+				}),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			must.NoError(t, err)
+			must.Eq(t, fmt.Sprintf("%v", val), test.want)
+		})
+	}
+}
+
+func TestNestedMacros(t *testing.T) {
+	elems := []string{"test", "example", "sample"}
+
+	tests := []struct {
+		name   string
+		values func() *celiter.Value[string]
+		want   string
+	}{
+		{
+			name: "slice",
+			values: func() *celiter.Value[string] {
+				return celiter.FromSlice(elems, nil)
+			},
+			want: "true",
+		},
+		{
+			name: "cached sequence",
+			values: func() *celiter.Value[string] {
+				return celiter.FromSeq(slices.Values(elems), nil, celiter.WithCache())
+			},
+			want: "true",
+		},
+		{
+			// Single-pass values share their position with the inner macro,
+			// which drains the remaining elements.
+			name: "sequence",
+			values: func() *celiter.Value[string] {
+				return celiter.FromSeq(slices.Values(elems), nil)
+			},
+			want: "false",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := test.values()
+
+			env, err := cel.NewEnv(
+				celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+					return values
+				}),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile("values().exists(x, x == 'sample' && values().exists(y, y == 'test'))")
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			must.NoError(t, err)
+			must.Eq(t, fmt.Sprintf("%v", val), test.want)
+		})
+	}
+}
+
+func TestIteratorSettings(t *testing.T) {
+	elems := []string{"test", "example", "sample"}
+
+	sources := map[string]func(convert celiter.Convert[string], opts ...celiter.Option) *celiter.Value[string]{
+		"slice": func(convert celiter.Convert[string], opts ...celiter.Option) *celiter.Value[string] {
+			return celiter.FromSlice(elems, convert, opts...)
+		},
+		"cached sequence": func(convert celiter.Convert[string], opts ...celiter.Option) *celiter.Value[string] {
+			return celiter.FromSeq(slices.Values(elems), convert, append(opts, celiter.WithCache())...)
+		},
+	}
+
+	eval := func(t *testing.T, values *celiter.Value[string], expr string) (ref.Val, error) {
+		t.Helper()
+
+		env, err := cel.NewEnv(
+			celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+				return values
+			}),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile(expr)
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		return val, err
+	}
+
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			t.Run("on next", func(t *testing.T) {
+				var indexes []int
+				values := source(nil, celiter.WithOnNext(func(index int, _ ref.Val) {
+					indexes = append(indexes, index)
+				}))
+
+				val, err := eval(t, values, "values().exists(x, x == 'example')")
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+				must.Eq(t, indexes, []int{0, 1, 2})
+			})
+
+			t.Run("logger", func(t *testing.T) {
+				var lines []string
+				values := source(nil, celiter.WithLogger(func(format string, args ...any) {
+					lines = append(lines, fmt.Sprintf(format, args...))
+				}))
+
+				val, err := eval(t, values, "values().exists(x, x == 'example')")
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+				must.Eq(t, lines, []string{
+					"HasNext() after index -1: true",
+					"Next() at index 0: test",
+					"HasNext() after index 0: true",
+					"Next() at index 1: example",
+					"HasNext() after index 1: true",
+					"Next() at index 2: sample",
+				})
+			})
+
+			t.Run("context", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				var errs []error
+				values := source(nil, celiter.WithContext(ctx), celiter.WithOnError(func(err error) {
+					errs = append(errs, err)
+				}))
+
+				val, _ := eval(t, values, "values().exists(x, x == 'example')")
+				must.NotEq(t, fmt.Sprintf("%v", val), "true")
+				must.SliceNotEmpty(t, errs)
+				must.ErrorIs(t, errs[0], context.Canceled)
+			})
+
+			t.Run("without recover", func(t *testing.T) {
+				values := source(func(string) ref.Val {
+					panic("boom")
+				}, celiter.WithoutRecover())
+				it := values.Iterator()
+
+				must.Eq[ref.Val](t, it.HasNext(), types.True)
+				defer func() {
+					must.NotNil(t, recover())
+				}()
+				it.Next()
+				t.Fatal("expected Next to panic")
+			})
+		})
+	}
+}
+
+func TestIntOverflowCheck(t *testing.T) {
+	toInt := func(v uint64) ref.Val {
+		return types.Int(v)
+	}
+
+	t.Run("overflow", func(t *testing.T) {
+		val := celiter.FromSlice([]uint64{1, math.MaxUint64}, toInt, celiter.WithIntOverflowCheck())
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(1))
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+
+		next := val.Next()
+		must.True(t, types.IsError(next))
+		must.StrContains(t, fmt.Sprintf("%v", next), "integer overflow")
+	})
+
+	t.Run("expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[uint64] {
+				return celiter.FromSlice([]uint64{1, math.MaxUint64}, toInt, celiter.WithIntOverflowCheck())
+			}),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values().all(x, x > 0)")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		_, _, err = prg.Eval(map[string]any{})
+		must.ErrorContains(t, err, "integer overflow")
+	})
+
+	t.Run("without check", func(t *testing.T) {
+		val := celiter.FromSlice([]uint64{math.MaxUint64}, toInt)
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(-1))
+	})
+
+	t.Run("in range", func(t *testing.T) {
+		val := celiter.FromSlice([]uint64{math.MaxInt64}, toInt, celiter.WithIntOverflowCheck())
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(math.MaxInt64))
+	})
+}
+
+func TestLogger(t *testing.T) {
+	var lines []string
+	logf := func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	env, err := cel.NewEnv(
+		celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+			return celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil, celiter.WithLogger(logf))
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile("values().exists(x, x == 'example')")
+	if issues != nil {
+		t.Fatalf("failed to compile CEL expression: %v", issues)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	val, _, err := prg.Eval(map[string]any{})
+	must.NoError(t, err)
+	must.Eq(t, fmt.Sprintf("%v", val), "true")
+
+	// The comprehension gets the element after the match before it checks
+	// its loop condition, so the log shows the extra element being read.
+	must.Eq(t, lines, []string{
+		"HasNext() after index -1: true",
+		"Next() at index 0: test",
+		"HasNext() after index 0: true",
+		"Next() at index 1: example",
+		"HasNext() after index 1: true",
+		"Next() at index 2: sample",
+	})
+
+	t.Run("get", func(t *testing.T) {
+		lines = nil
+		val := celiter.FromSeq(slices.Values([]string{"test", "example"}), nil, celiter.WithLogger(logf))
+		val.Get(types.Int(1))
+		val.Get(types.Int(5))
+		must.Eq(t, lines, []string{
+			"Get(1) at index 1: example",
+			"Get(5) at index 1: index out of bounds during iterable access",
+		})
+	})
+}
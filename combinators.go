@@ -0,0 +1,801 @@
+package celiter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Take returns a new iterable Value instance which yields at most the first n
+// elements of v. This bounds infinite iterables, so operations like Size can
+// be used on the result.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Take[T any](v *Value[T], n int) *Value[T] {
+	var taken int
+
+	hasNext := func() (bool, error) {
+		if taken >= n {
+			return false, nil
+		}
+		return v.checkNext()
+	}
+
+	next := func() (T, error) {
+		next, err := v.advance()
+		if err != nil {
+			return next, err
+		}
+		taken++
+		return next, nil
+	}
+
+	restart := func() error {
+		taken = 0
+		return v.Reset()
+	}
+
+	return New(hasNext, next, v.convert, WithRestart(restart), WithClose(v.Close))
+}
+
+// Skip returns a new iterable Value instance which discards the first n
+// elements of v and yields the rest. The elements are discarded the first
+// time the returned value is advanced.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Skip[T any](v *Value[T], n int) *Value[T] {
+	var discarded int
+
+	skip := func() error {
+		for ; discarded < n; discarded++ {
+			ok, err := v.checkNext()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				discarded = n
+				break
+			}
+			if _, err := v.advance(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	hasNext := func() (bool, error) {
+		if err := skip(); err != nil {
+			return false, err
+		}
+		return v.checkNext()
+	}
+
+	next := func() (T, error) {
+		if err := skip(); err != nil {
+			var zero T
+			return zero, err
+		}
+		return v.advance()
+	}
+
+	restart := func() error {
+		discarded = 0
+		return v.Reset()
+	}
+
+	return New(hasNext, next, v.convert, WithRestart(restart), WithClose(v.Close))
+}
+
+// Slice returns a new iterable Value instance which lazily yields the
+// elements of v with indexes in the range [start, end), like slicing a list.
+// Since it stops at end, it can be used with infinite iterables. If end is
+// not greater than start, no elements are yielded.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Slice[T any](v *Value[T], start, end int) *Value[T] {
+	return Take(Skip(v, start), max(end-start, 0))
+}
+
+// Map returns a new iterable Value instance which lazily applies f to each
+// element of v as it is yielded, converting the results with convert.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Map[T, U any](v *Value[T], f func(T) U, convert Convert[U]) *Value[U] {
+	next := func() (U, error) {
+		next, err := v.advance()
+		if err != nil {
+			var zero U
+			return zero, err
+		}
+		return f(next), nil
+	}
+
+	return New(v.checkNext, next, convert, WithRestart(v.Reset), WithClose(v.Close))
+}
+
+// FlatMap returns a new iterable Value instance which lazily applies f to
+// each element of v, yielding every element of the resulting iterable before
+// advancing v, converting them with convert. Empty iterables returned by f
+// are skipped.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func FlatMap[T, U any](v *Value[T], f func(T) *Value[U], convert Convert[U]) *Value[U] {
+	var sub *Value[U]
+
+	hasNext := func() (bool, error) {
+		for {
+			if sub != nil {
+				ok, err := sub.checkNext()
+				if err != nil || ok {
+					return ok, err
+				}
+				if err := sub.Close(); err != nil {
+					return false, err
+				}
+				sub = nil
+			}
+
+			ok, err := v.checkNext()
+			if err != nil || !ok {
+				return false, err
+			}
+			next, err := v.advance()
+			if err != nil {
+				return false, err
+			}
+			sub = f(next)
+		}
+	}
+
+	next := func() (U, error) {
+		if sub == nil {
+			var zero U
+			return zero, fmt.Errorf("no next element")
+		}
+		return sub.advance()
+	}
+
+	restart := func() error {
+		sub = nil
+		return v.Reset()
+	}
+
+	close := func() error {
+		var err error
+		if sub != nil {
+			err = sub.Close()
+		}
+		return errors.Join(err, v.Close())
+	}
+
+	return New(hasNext, next, convert, WithRestart(restart), WithClose(close))
+}
+
+// Flatten returns a new iterable Value instance which lazily yields every
+// element of each iterable yielded by v, in order, converting them with
+// convert. Empty iterables are skipped, and each one is closed once it is
+// exhausted, like with FlatMap.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Flatten[U any](v *Value[*Value[U]], convert Convert[U]) *Value[U] {
+	return FlatMap(v, func(sub *Value[U]) *Value[U] {
+		return sub
+	}, convert)
+}
+
+// Filter returns a new iterable Value instance which only yields the
+// elements of v that satisfy pred.
+//
+// Checking for the next element advances v until a matching element is found,
+// which is buffered for the following Next. If an infinite source never
+// yields another matching element, the check never returns.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Filter[T any](v *Value[T], pred func(T) bool) *Value[T] {
+	var (
+		cur   T
+		found bool
+	)
+
+	hasNext := func() (bool, error) {
+		for !found {
+			ok, err := v.checkNext()
+			if err != nil || !ok {
+				return false, err
+			}
+			next, err := v.advance()
+			if err != nil {
+				return false, err
+			}
+			cur, found = next, pred(next)
+		}
+		return true, nil
+	}
+
+	next := func() (T, error) {
+		ok, err := hasNext()
+		if err != nil || !ok {
+			var zero T
+			if err == nil {
+				err = fmt.Errorf("no next element")
+			}
+			return zero, err
+		}
+		found = false
+		return cur, nil
+	}
+
+	restart := func() error {
+		found = false
+		return v.Reset()
+	}
+
+	return New(hasNext, next, v.convert, WithRestart(restart), WithClose(v.Close))
+}
+
+// MapFilter returns a new iterable Value instance which applies f to each
+// element of v, yielding the results for which f also returns true, and
+// converting them with convert. It is equivalent to Map followed by Filter,
+// but in a single pass, without the intermediate value.
+//
+// Like Filter, checking for the next element advances v until a matching
+// element is found, which is buffered for the following Next.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func MapFilter[T, U any](v *Value[T], f func(T) (U, bool), convert Convert[U]) *Value[U] {
+	var (
+		cur   U
+		found bool
+	)
+
+	hasNext := func() (bool, error) {
+		for !found {
+			ok, err := v.checkNext()
+			if err != nil || !ok {
+				return false, err
+			}
+			next, err := v.advance()
+			if err != nil {
+				return false, err
+			}
+			cur, found = f(next)
+		}
+		return true, nil
+	}
+
+	next := func() (U, error) {
+		ok, err := hasNext()
+		if err != nil || !ok {
+			var zero U
+			if err == nil {
+				err = fmt.Errorf("no next element")
+			}
+			return zero, err
+		}
+		found = false
+		return cur, nil
+	}
+
+	restart := func() error {
+		found = false
+		return v.Reset()
+	}
+
+	return New(hasNext, next, convert, WithRestart(restart), WithClose(v.Close))
+}
+
+// TakeWhile returns a new iterable Value instance which yields the elements
+// of v until the first one that doesn't satisfy pred, like taking the
+// Fibonacci numbers below 100 from an infinite sequence.
+//
+// Checking for the next element advances v to test it against pred, and the
+// element is buffered for the following Next. The first element which fails
+// the test is discarded.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func TakeWhile[T any](v *Value[T], pred func(T) bool) *Value[T] {
+	var (
+		cur         T
+		found, done bool
+	)
+
+	hasNext := func() (bool, error) {
+		if found {
+			return true, nil
+		}
+		if done {
+			return false, nil
+		}
+		ok, err := v.checkNext()
+		if err != nil || !ok {
+			return false, err
+		}
+		next, err := v.advance()
+		if err != nil {
+			return false, err
+		}
+		if !pred(next) {
+			done = true
+			return false, nil
+		}
+		cur, found = next, true
+		return true, nil
+	}
+
+	next := func() (T, error) {
+		ok, err := hasNext()
+		if err != nil || !ok {
+			var zero T
+			if err == nil {
+				err = fmt.Errorf("no next element")
+			}
+			return zero, err
+		}
+		found = false
+		return cur, nil
+	}
+
+	restart := func() error {
+		found, done = false, false
+		return v.Reset()
+	}
+
+	return New(hasNext, next, v.convert, WithRestart(restart), WithClose(v.Close))
+}
+
+// DropWhile returns a new iterable Value instance which discards the leading
+// elements of v that satisfy pred, and yields the rest, starting with the
+// first element which doesn't.
+//
+// If an infinite source never yields an element which fails pred, checking
+// for the next element never returns.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func DropWhile[T any](v *Value[T], pred func(T) bool) *Value[T] {
+	dropping := true
+
+	drop := Filter(v, func(t T) bool {
+		if dropping && pred(t) {
+			return false
+		}
+		dropping = false
+		return true
+	})
+
+	restart := drop.restart
+	drop.restart = func() error {
+		dropping = true
+		return restart()
+	}
+
+	return drop
+}
+
+// Chain returns a new iterable Value instance which yields every element of
+// the first iterable, then every element of the next, and so on, as if they
+// were a single iterable. Elements are converted with the converter of the
+// first iterable.
+//
+// The returned value shares its position with the given values, so they
+// should not be used directly afterward.
+func Chain[T any](vs ...*Value[T]) *Value[T] {
+	var (
+		i       int
+		convert Convert[T]
+	)
+
+	if len(vs) > 0 {
+		convert = vs[0].convert
+	}
+
+	hasNext := func() (bool, error) {
+		for ; i < len(vs); i++ {
+			ok, err := vs[i].checkNext()
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	next := func() (T, error) {
+		if i >= len(vs) {
+			var zero T
+			return zero, fmt.Errorf("no next element")
+		}
+		return vs[i].advance()
+	}
+
+	restart := func() error {
+		i = 0
+		for _, v := range vs {
+			if err := v.Reset(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	close := func() error {
+		var errs []error
+		for _, v := range vs {
+			errs = append(errs, v.Close())
+		}
+		return errors.Join(errs...)
+	}
+
+	return New(hasNext, next, convert, WithRestart(restart), WithClose(close))
+}
+
+// MergeSorted returns a new iterable Value instance which merges the
+// elements of the given values, each already sorted by less, into a single
+// sorted iterable, like merging time-ordered event streams. Equal elements
+// are yielded in the order of the values they come from.
+//
+// The merge is lazy: only the next element of each value is buffered, so it
+// can be used with infinite sorted sources. Elements are converted with the
+// converter of the first value.
+//
+// The returned value shares its position with the given values, so they
+// should not be used directly afterward.
+func MergeSorted[T any](less func(T, T) bool, vs ...*Value[T]) *Value[T] {
+	var convert Convert[T]
+	if len(vs) > 0 {
+		convert = vs[0].convert
+	}
+
+	// pick buffers the next element of each value, and returns the index of
+	// the value with the smallest one, or -1 if they are all exhausted.
+	pick := func() (int, error) {
+		best := -1
+		for i, v := range vs {
+			if !v.peeked {
+				ok, err := v.checkNext()
+				if err != nil {
+					return -1, err
+				}
+				if !ok {
+					continue
+				}
+				if v.peek, err = v.fetch(); err != nil {
+					return -1, err
+				}
+				v.peeked = true
+			}
+			if best < 0 || less(v.peek, vs[best].peek) {
+				best = i
+			}
+		}
+		return best, nil
+	}
+
+	hasNext := func() (bool, error) {
+		i, err := pick()
+		return i >= 0, err
+	}
+
+	next := func() (T, error) {
+		i, err := pick()
+		if err != nil || i < 0 {
+			var zero T
+			if err == nil {
+				err = fmt.Errorf("no next element")
+			}
+			return zero, err
+		}
+		return vs[i].advance()
+	}
+
+	restart := func() error {
+		for _, v := range vs {
+			if err := v.Reset(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	close := func() error {
+		var errs []error
+		for _, v := range vs {
+			errs = append(errs, v.Close())
+		}
+		return errors.Join(errs...)
+	}
+
+	return New(hasNext, next, convert, WithRestart(restart), WithClose(close))
+}
+
+// Zip returns a new iterable Value instance which pairs up the elements of a
+// and b, yielding the result of combine for each pair. It stops as soon as
+// either iterable is exhausted, so zipping an infinite iterable with a finite
+// one yields as many elements as the finite one.
+//
+// The returned value shares its position with a and b, so they should not be
+// used directly afterward.
+func Zip[A, B any](a *Value[A], b *Value[B], combine func(A, B) ref.Val) *Value[ref.Val] {
+	hasNext := func() (bool, error) {
+		ok, err := a.checkNext()
+		if err != nil || !ok {
+			return false, err
+		}
+		return b.checkNext()
+	}
+
+	next := func() (ref.Val, error) {
+		nextA, err := a.advance()
+		if err != nil {
+			return nil, err
+		}
+		nextB, err := b.advance()
+		if err != nil {
+			return nil, err
+		}
+		return combine(nextA, nextB), nil
+	}
+
+	restart := func() error {
+		return errors.Join(a.Reset(), b.Reset())
+	}
+
+	close := func() error {
+		return errors.Join(a.Close(), b.Close())
+	}
+
+	return New(hasNext, next, func(v ref.Val) ref.Val { return v }, WithRestart(restart), WithClose(close))
+}
+
+// Cycle returns a new iterable Value instance which yields the elements of v
+// over and over, resetting v each time it is exhausted, so v must be
+// restartable (see WithRestart). If v has no elements, neither does the
+// returned value.
+//
+// Unless v is empty, the returned value is infinite, so Size never returns,
+// unless a limit is set with WithSizeLimit, and it should be bounded first,
+// like with Take.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Cycle[T any](v *Value[T]) *Value[T] {
+	var yielded bool
+
+	hasNext := func() (bool, error) {
+		ok, err := v.checkNext()
+		if err != nil || ok || !yielded {
+			return ok, err
+		}
+		if err := v.Reset(); err != nil {
+			return false, err
+		}
+		return v.checkNext()
+	}
+
+	next := func() (T, error) {
+		next, err := v.advance()
+		if err != nil {
+			return next, err
+		}
+		yielded = true
+		return next, nil
+	}
+
+	restart := func() error {
+		yielded = false
+		return v.Reset()
+	}
+
+	return New(hasNext, next, v.convert, WithRestart(restart), WithClose(v.Close))
+}
+
+// Distinct returns a new iterable Value instance which only yields the first
+// occurrence of each element of v.
+//
+// Every yielded element is kept in a set to detect repeats, so memory grows
+// with the number of distinct elements. It should not be used with large or
+// infinite sources with many distinct elements, see Compact to only skip
+// consecutive repeats instead.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Distinct[T comparable](v *Value[T]) *Value[T] {
+	seen := make(map[T]struct{})
+
+	distinct := Filter(v, func(t T) bool {
+		if _, ok := seen[t]; ok {
+			return false
+		}
+		seen[t] = struct{}{}
+		return true
+	})
+
+	restart := distinct.restart
+	distinct.restart = func() error {
+		clear(seen)
+		return restart()
+	}
+
+	return distinct
+}
+
+// Compact returns a new iterable Value instance which skips elements of v
+// equal to the element yielded right before them, like the Unix uniq command.
+// Only the last yielded element is kept, so unlike Distinct, it can be used
+// with infinite sources.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Compact[T comparable](v *Value[T]) *Value[T] {
+	var (
+		last T
+		seen bool
+	)
+
+	compact := Filter(v, func(t T) bool {
+		if seen && t == last {
+			return false
+		}
+		last, seen = t, true
+		return true
+	})
+
+	restart := compact.restart
+	compact.restart = func() error {
+		var zero T
+		last, seen = zero, false
+		return restart()
+	}
+
+	return compact
+}
+
+// Tee returns two new iterable Value instances which both yield every
+// element of v, so two consumers can read the same source, like when an
+// expression references the same iterable twice.
+//
+// Elements read by one value are buffered until the other catches up, so if
+// one is consumed much further than the other, like when only one of them
+// drains an infinite source, the buffer grows without bound. The source is
+// closed once both values are closed.
+//
+// The returned values share their position with v, so v should not be used
+// directly afterward.
+func Tee[T any](v *Value[T]) (*Value[T], *Value[T]) {
+	var (
+		bufs   [2][]T
+		closed [2]bool
+	)
+
+	branch := func(i int) *Value[T] {
+		hasNext := func() (bool, error) {
+			if len(bufs[i]) > 0 {
+				return true, nil
+			}
+			ok, err := v.checkNext()
+			if err != nil || !ok {
+				return false, err
+			}
+			next, err := v.advance()
+			if err != nil {
+				return false, err
+			}
+			for j := range bufs {
+				if !closed[j] {
+					bufs[j] = append(bufs[j], next)
+				}
+			}
+			return true, nil
+		}
+
+		next := func() (T, error) {
+			if len(bufs[i]) == 0 {
+				var zero T
+				return zero, fmt.Errorf("no next element")
+			}
+			next := bufs[i][0]
+			bufs[i] = bufs[i][1:]
+			return next, nil
+		}
+
+		close := func() error {
+			closed[i], bufs[i] = true, nil
+			if closed[0] && closed[1] {
+				return v.Close()
+			}
+			return nil
+		}
+
+		return New(hasNext, next, v.convert, WithClose(close))
+	}
+
+	return branch(0), branch(1)
+}
+
+// Reverse returns a new iterable Value instance which yields the remaining
+// elements of v in reverse order. The elements are drained from v and kept
+// in memory, so the returned value knows its size (see SizeHinter).
+//
+// Reverse never returns for infinite sources, unless a limit is set on v
+// with WithSizeLimit, in which case an error is returned once it is
+// exceeded.
+func Reverse[T any](v *Value[T]) (*Value[T], error) {
+	elems, err := v.drain()
+	if err != nil {
+		return nil, fmt.Errorf("unable to reverse %s: %w", v.Type().TypeName(), err)
+	}
+
+	slices.Reverse(elems)
+
+	return FromSlice(elems, v.convert, WithAdapter(v.adapter), WithClose(v.Close)), nil
+}
+
+// Batch returns a new iterable Value instance which groups consecutive
+// elements of v into slices of n elements, yielding each slice as a single
+// element converted with convert. The last batch has fewer than n elements if
+// v runs out. If n is less than 1, each batch has a single element.
+//
+// The returned value shares its position with v, so v should not be used
+// directly afterward.
+func Batch[T any](v *Value[T], n int, convert Convert[[]T]) *Value[[]T] {
+	n = max(n, 1)
+
+	next := func() ([]T, error) {
+		batch := make([]T, 0, n)
+		for {
+			next, err := v.advance()
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, next)
+			if len(batch) == n {
+				return batch, nil
+			}
+			ok, err := v.checkNext()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return batch, nil
+			}
+		}
+	}
+
+	return New(v.checkNext, next, convert, WithRestart(v.Reset), WithClose(v.Close))
+}
+
+// Sorted returns a new iterable Value instance which yields the remaining
+// elements of v sorted by less, keeping equal elements in their original
+// order. Like Reverse, the elements are drained from v and kept in memory.
+//
+// Sorted never returns for infinite sources, unless a limit is set on v
+// with WithSizeLimit, in which case an error is returned once it is
+// exceeded.
+func Sorted[T any](v *Value[T], less func(T, T) bool) (*Value[T], error) {
+	elems, err := v.drain()
+	if err != nil {
+		return nil, fmt.Errorf("unable to sort %s: %w", v.Type().TypeName(), err)
+	}
+
+	slices.SortStableFunc(elems, func(a, b T) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	})
+
+	return FromSlice(elems, v.convert, WithAdapter(v.adapter), WithClose(v.Close)), nil
+}
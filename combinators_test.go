@@ -0,0 +1,854 @@
+package celiter_test
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+var fibonacciSeq iter.Seq[int] = func(yield func(int) bool) {
+	a, b := 0, 1
+	for {
+		if !yield(a) {
+			return
+		}
+		a, b = b, a+b
+	}
+}
+
+func fibonacciConvert(v int) ref.Val {
+	return types.Int(v)
+}
+
+func collectInts(val ref.Val) []int {
+	return slices.Collect(celiter.AsSeq(val, func(v ref.Val) int {
+		return int(v.Value().(int64))
+	}))
+}
+
+func TestTake(t *testing.T) {
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.FromSeq(fibonacciSeq, fibonacciConvert), 5)
+		must.Eq(t, collectInts(val), []int{0, 1, 1, 2, 3})
+	})
+
+	t.Run("more than length", func(t *testing.T) {
+		val := celiter.Take(celiter.FromSeq(slices.Values([]int{1, 2}), fibonacciConvert), 5)
+		must.Eq(t, collectInts(val), []int{1, 2})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.Take(celiter.FromSeq(fibonacciSeq, fibonacciConvert), 3)
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{0, 1, 1})
+	})
+
+	t.Run("size expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Function(
+				"fibonacci",
+				cel.Overload(
+					"fibonacci_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.Take(celiter.FromSeq(fibonacciSeq, fibonacciConvert), 5)
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("size(fibonacci()) == 5")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+	})
+}
+
+func TestSkip(t *testing.T) {
+	t.Run("skip prefix", func(t *testing.T) {
+		val := celiter.Skip(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4, 5}), fibonacciConvert), 3)
+		must.Eq(t, collectInts(val), []int{4, 5})
+	})
+
+	t.Run("skip more than length", func(t *testing.T) {
+		val := celiter.Skip(celiter.FromSeq(slices.Values([]int{1, 2, 3}), fibonacciConvert), 5)
+		must.Eq(t, collectInts(val), nil)
+		must.Eq[ref.Val](t, val.Size(), types.Int(0))
+	})
+
+	t.Run("skip infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.Skip(celiter.FromSeq(fibonacciSeq, fibonacciConvert), 5), 3)
+		must.Eq(t, collectInts(val), []int{5, 8, 13})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.Skip(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4, 5}), fibonacciConvert), 2)
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{3, 4, 5})
+	})
+}
+
+func TestSlice(t *testing.T) {
+	t.Run("middle", func(t *testing.T) {
+		val := celiter.Slice(celiter.FromSeq(slices.Values([]int{10, 20, 30, 40}), fibonacciConvert), 1, 3)
+		must.Eq(t, collectInts(val), []int{20, 30})
+	})
+
+	t.Run("past end", func(t *testing.T) {
+		val := celiter.Slice(celiter.FromSeq(slices.Values([]int{10, 20, 30, 40}), fibonacciConvert), 2, 10)
+		must.Eq(t, collectInts(val), []int{30, 40})
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		val := celiter.Slice(celiter.FromSeq(slices.Values([]int{10, 20, 30, 40}), fibonacciConvert), 3, 1)
+		must.Eq(t, collectInts(val), nil)
+	})
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Slice(celiter.FromSeq(fibonacciSeq, fibonacciConvert), 5, 8)
+		must.Eq(t, collectInts(val), []int{5, 8, 13})
+	})
+}
+
+func TestMap(t *testing.T) {
+	double := func(v int) int {
+		return v * 2
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "true exists expression",
+			expr: "values().exists(x, x == 6)",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "false exists expression",
+			expr: "values().exists(x, x == 3)",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name: "index expression",
+			expr: "values()[1] == 4",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.Map(
+								celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil),
+								double,
+								fibonacciConvert,
+							)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.Map(celiter.FromSeq(fibonacciSeq, nil), double, fibonacciConvert), 5)
+		must.Eq(t, collectInts(val), []int{0, 2, 2, 4, 6})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		val := celiter.Map(
+			celiter.New(
+				func() (bool, error) {
+					return true, nil
+				},
+				func() (int, error) {
+					return 0, errSentinel
+				},
+				nil,
+			),
+			double,
+			fibonacciConvert,
+		)
+
+		err, ok := val.Next().(*types.Err)
+		must.True(t, ok)
+		must.ErrorIs(t, err, errSentinel)
+	})
+}
+
+func TestFlatMap(t *testing.T) {
+	ranges := func(n int) *celiter.Value[int] {
+		values := make([]int, n+1)
+		for i := range values {
+			values[i] = i
+		}
+		return celiter.FromSlice(values, nil)
+	}
+
+	t.Run("ranges", func(t *testing.T) {
+		val := celiter.FlatMap(celiter.FromSeq(slices.Values([]int{1, 2}), nil), ranges, fibonacciConvert)
+		must.Eq(t, collectInts(val), []int{0, 1, 0, 1, 2})
+	})
+
+	t.Run("empty sub-iterables", func(t *testing.T) {
+		val := celiter.FlatMap(celiter.FromSeq(slices.Values([]int{-1, 1, -1, 0, -1}), nil), ranges, fibonacciConvert)
+		must.Eq(t, collectInts(val), []int{0, 1, 0})
+	})
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.FlatMap(celiter.FromSeq(fibonacciSeq, nil), ranges, fibonacciConvert), 6)
+		must.Eq(t, collectInts(val), []int{0, 0, 1, 0, 1, 0})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.FlatMap(celiter.FromSeq(slices.Values([]int{1, 2}), nil), ranges, fibonacciConvert)
+		must.Eq[ref.Val](t, val.Size(), types.Int(5))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{0, 1, 0, 1, 2})
+	})
+}
+
+func TestFlatten(t *testing.T) {
+	t.Run("two inner values", func(t *testing.T) {
+		val := celiter.Flatten(celiter.FromSlice([]*celiter.Value[int]{
+			celiter.FromSlice([]int{1, 2}, nil),
+			celiter.FromSlice([]int{3, 4, 5}, nil),
+		}, nil), fibonacciConvert)
+		must.Eq(t, collectInts(val), []int{1, 2, 3, 4, 5})
+	})
+
+	t.Run("empty inner values", func(t *testing.T) {
+		val := celiter.Flatten(celiter.FromSlice([]*celiter.Value[int]{
+			celiter.Empty[int](),
+			celiter.FromSlice([]int{1}, nil),
+			celiter.Empty[int](),
+			celiter.Empty[int](),
+			celiter.FromSlice([]int{2}, nil),
+		}, nil), fibonacciConvert)
+		must.Eq(t, collectInts(val), []int{1, 2})
+	})
+
+	t.Run("infinite inner value", func(t *testing.T) {
+		val := celiter.Take(celiter.Flatten(celiter.FromSlice([]*celiter.Value[int]{
+			celiter.FromSlice([]int{-1}, nil),
+			celiter.FromSeq(fibonacciSeq, nil),
+		}, nil), fibonacciConvert), 4)
+		must.Eq(t, collectInts(val), []int{-1, 0, 1, 1})
+	})
+}
+
+func TestFilter(t *testing.T) {
+	even := func(v int) bool {
+		return v%2 == 0
+	}
+
+	t.Run("even numbers", func(t *testing.T) {
+		val := celiter.Filter(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4}), fibonacciConvert), even)
+		must.Eq(t, collectInts(val), []int{2, 4})
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		val := celiter.Filter(celiter.FromSeq(slices.Values([]int{1, 3, 5}), fibonacciConvert), even)
+		must.Eq[ref.Val](t, val.Size(), types.Int(0))
+	})
+
+	t.Run("repeated has next", func(t *testing.T) {
+		val := celiter.Filter(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4}), fibonacciConvert), even)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(2))
+		must.Eq[ref.Val](t, val.Next(), types.Int(4))
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.Filter(celiter.FromSeq(fibonacciSeq, fibonacciConvert), even), 4)
+		must.Eq(t, collectInts(val), []int{0, 2, 8, 34})
+	})
+
+	t.Run("index expression", func(t *testing.T) {
+		val := celiter.Filter(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4}), fibonacciConvert), even)
+		must.Eq[ref.Val](t, val.Get(types.Int(1)), types.Int(4))
+	})
+}
+
+func TestMapFilter(t *testing.T) {
+	halfEven := func(v int) (int, bool) {
+		return v / 2, v%2 == 0
+	}
+
+	t.Run("even numbers", func(t *testing.T) {
+		val := celiter.MapFilter(celiter.FromSlice([]int{1, 2, 3, 4}, nil), halfEven, fibonacciConvert)
+		must.Eq(t, collectInts(val), []int{1, 2})
+	})
+
+	t.Run("same as map and filter", func(t *testing.T) {
+		fused := celiter.Take(celiter.MapFilter(celiter.FromSeq(fibonacciSeq, nil), halfEven, fibonacciConvert), 5)
+
+		chained := celiter.Take(celiter.Map(celiter.Filter(celiter.FromSeq(fibonacciSeq, nil), func(v int) bool {
+			return v%2 == 0
+		}), func(v int) int {
+			return v / 2
+		}, fibonacciConvert), 5)
+
+		must.Eq(t, collectInts(fused), collectInts(chained))
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		val := celiter.MapFilter(celiter.FromSlice([]int{1, 3, 5}, nil), halfEven, fibonacciConvert)
+		must.Eq[ref.Val](t, val.Size(), types.Int(0))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.MapFilter(celiter.FromSlice([]int{1, 2, 3, 4}, nil), halfEven, fibonacciConvert)
+		must.Eq[ref.Val](t, val.Size(), types.Int(2))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{1, 2})
+	})
+}
+
+func BenchmarkMapFilter(b *testing.B) {
+	values := make([]int, 1000)
+	for i := range values {
+		values[i] = i
+	}
+
+	b.Run("fused", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			val := celiter.MapFilter(celiter.FromSlice(values, nil), func(v int) (int, bool) {
+				return v / 2, v%2 == 0
+			}, fibonacciConvert)
+			val.Size()
+		}
+	})
+
+	b.Run("chained", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			val := celiter.Map(celiter.Filter(celiter.FromSlice(values, nil), func(v int) bool {
+				return v%2 == 0
+			}), func(v int) int {
+				return v / 2
+			}, fibonacciConvert)
+			val.Size()
+		}
+	})
+}
+
+func TestTakeWhile(t *testing.T) {
+	below := func(n int) func(int) bool {
+		return func(v int) bool {
+			return v < n
+		}
+	}
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.TakeWhile(celiter.FromSeq(fibonacciSeq, fibonacciConvert), below(100))
+		must.Eq(t, collectInts(val), []int{0, 1, 1, 2, 3, 5, 8, 13, 21, 34, 55, 89})
+	})
+
+	t.Run("all match", func(t *testing.T) {
+		val := celiter.TakeWhile(celiter.FromSlice([]int{1, 2, 3}, fibonacciConvert), below(10))
+		must.Eq(t, collectInts(val), []int{1, 2, 3})
+	})
+
+	t.Run("repeated has next", func(t *testing.T) {
+		val := celiter.TakeWhile(celiter.FromSlice([]int{1, 2, 3}, fibonacciConvert), below(3))
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(1))
+		must.Eq[ref.Val](t, val.Next(), types.Int(2))
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.TakeWhile(celiter.FromSlice([]int{1, 2, 3, 1}, fibonacciConvert), below(3))
+		must.Eq[ref.Val](t, val.Size(), types.Int(2))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{1, 2})
+	})
+}
+
+func TestDropWhile(t *testing.T) {
+	below := func(n int) func(int) bool {
+		return func(v int) bool {
+			return v < n
+		}
+	}
+
+	t.Run("ascending sequence", func(t *testing.T) {
+		val := celiter.DropWhile(celiter.FromSlice([]int{1, 2, 3, 4, 1}, fibonacciConvert), below(3))
+		must.Eq(t, collectInts(val), []int{3, 4, 1})
+	})
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.DropWhile(celiter.FromSeq(fibonacciSeq, fibonacciConvert), below(100)), 3)
+		must.Eq(t, collectInts(val), []int{144, 233, 377})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.DropWhile(celiter.FromSlice([]int{1, 2, 3, 1}, fibonacciConvert), below(3))
+		must.Eq[ref.Val](t, val.Size(), types.Int(2))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{3, 1})
+	})
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "size expression",
+			expr: "size(values()) == 6",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "index expression across boundary",
+			expr: "values()[4] == 'five'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "true in expression",
+			expr: "'six' in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "exists expression",
+			expr: "values().exists(x, x == 'two')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.Chain(
+								celiter.FromSeq(slices.Values([]string{"one", "two", "three"}), nil),
+								celiter.FromSeq(slices.Values([]string{}), nil),
+								celiter.FromSeq(slices.Values([]string{"four", "five", "six"}), nil),
+							)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("no iterables", func(t *testing.T) {
+		val := celiter.Chain[int]()
+		must.Eq[ref.Val](t, val.Size(), types.Int(0))
+	})
+}
+
+func TestMergeSorted(t *testing.T) {
+	less := func(a, b int) bool {
+		return a < b
+	}
+
+	t.Run("two values", func(t *testing.T) {
+		val := celiter.MergeSorted(less,
+			celiter.FromSlice([]int{1, 3, 5}, fibonacciConvert),
+			celiter.FromSlice([]int{2, 4, 6}, fibonacciConvert),
+		)
+		must.Eq(t, collectInts(val), []int{1, 2, 3, 4, 5, 6})
+	})
+
+	t.Run("uneven values", func(t *testing.T) {
+		val := celiter.MergeSorted(less,
+			celiter.FromSlice([]int{1, 2, 10}, fibonacciConvert),
+			celiter.FromSlice([]int{}, fibonacciConvert),
+			celiter.FromSlice([]int{2, 3}, fibonacciConvert),
+		)
+		must.Eq(t, collectInts(val), []int{1, 2, 2, 3, 10})
+	})
+
+	t.Run("infinite values", func(t *testing.T) {
+		val := celiter.Take(celiter.MergeSorted(less,
+			celiter.FromSeq(fibonacciSeq, fibonacciConvert),
+			celiter.Map(celiter.Range(0, math.MaxInt64, 10, nil), func(v int64) int {
+				return int(v)
+			}, fibonacciConvert),
+		), 8)
+		must.Eq(t, collectInts(val), []int{0, 0, 1, 1, 2, 3, 5, 8})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.MergeSorted(less,
+			celiter.FromSlice([]int{1, 3}, fibonacciConvert),
+			celiter.FromSlice([]int{2}, fibonacciConvert),
+		)
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{1, 2, 3})
+	})
+
+	t.Run("none", func(t *testing.T) {
+		must.Eq[ref.Val](t, celiter.MergeSorted(less).Size(), types.Int(0))
+	})
+}
+
+func TestZip(t *testing.T) {
+	combine := func(s string, n int) ref.Val {
+		return types.NewDynamicList(types.DefaultTypeAdapter, []any{s, n})
+	}
+
+	t.Run("shorter first", func(t *testing.T) {
+		val := celiter.Zip(
+			celiter.FromSeq(slices.Values([]string{"a", "b"}), nil),
+			celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil),
+			combine,
+		)
+
+		must.Eq[ref.Val](t, val.Get(types.Int(0)).Equal(types.NewDynamicList(types.DefaultTypeAdapter, []any{"a", 1})), types.True)
+		must.Eq[ref.Val](t, val.Get(types.Int(1)).Equal(types.NewDynamicList(types.DefaultTypeAdapter, []any{"b", 2})), types.True)
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("infinite second", func(t *testing.T) {
+		val := celiter.Zip(
+			celiter.FromSeq(slices.Values([]string{"a", "b"}), nil),
+			celiter.FromSeq(fibonacciSeq, nil),
+			combine,
+		)
+
+		must.Eq[ref.Val](t, val.Size(), types.Int(2))
+	})
+
+	t.Run("exists expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Function(
+				"values",
+				cel.Overload(
+					"test_values",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.Zip(
+							celiter.FromSeq(slices.Values([]string{"a", "b"}), nil),
+							celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil),
+							combine,
+						)
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values().exists(p, p[0] == 'b' && p[1] == 2)")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+	})
+}
+
+func TestCycle(t *testing.T) {
+	t.Run("take", func(t *testing.T) {
+		val := celiter.Take(celiter.Cycle(celiter.FromSeq(slices.Values([]int{1, 2, 3}), fibonacciConvert)), 7)
+		must.Eq(t, collectInts(val), []int{1, 2, 3, 1, 2, 3, 1})
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		val := celiter.Cycle(celiter.FromSeq(slices.Values([]int{}), fibonacciConvert))
+		must.Eq[ref.Val](t, val.Size(), types.Int(0))
+	})
+
+	t.Run("not restartable", func(t *testing.T) {
+		values := []int{1, 2}
+		val := celiter.Cycle(celiter.FromChannel(func() <-chan int {
+			ch := make(chan int, len(values))
+			for _, v := range values {
+				ch <- v
+			}
+			close(ch)
+			return ch
+		}(), fibonacciConvert))
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(1))
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(2))
+		must.True(t, types.IsError(val.HasNext()))
+	})
+}
+
+func TestDistinct(t *testing.T) {
+	newValues := func() *celiter.Value[string] {
+		return celiter.Distinct(celiter.FromSeq(slices.Values([]string{"a", "a", "b", "a", "c"}), nil))
+	}
+
+	t.Run("collect", func(t *testing.T) {
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](newValues(), nil)), []string{"a", "b", "c"})
+	})
+
+	t.Run("size", func(t *testing.T) {
+		must.Eq[ref.Val](t, newValues().Size(), types.Int(3))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := newValues()
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+	})
+}
+
+func TestCompact(t *testing.T) {
+	newValues := func() *celiter.Value[string] {
+		return celiter.Compact(celiter.FromSlice([]string{"a", "a", "b", "b", "a"}, nil))
+	}
+
+	t.Run("collect", func(t *testing.T) {
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](newValues(), nil)), []string{"a", "b", "a"})
+	})
+
+	t.Run("infinite", func(t *testing.T) {
+		must.Eq(t, collectInts(celiter.Take(celiter.Compact(celiter.FromSeq(fibonacciSeq, fibonacciConvert)), 4)), []int{0, 1, 2, 3})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := newValues()
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.NoError(t, val.Reset())
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+	})
+}
+
+func TestTee(t *testing.T) {
+	t.Run("sequential", func(t *testing.T) {
+		a, b := celiter.Tee(celiter.FromSeq(slices.Values([]int{1, 2, 3}), fibonacciConvert))
+		must.Eq(t, collectInts(a), []int{1, 2, 3})
+		must.Eq(t, collectInts(b), []int{1, 2, 3})
+	})
+
+	t.Run("interleaved", func(t *testing.T) {
+		a, b := celiter.Tee(celiter.FromSeq(fibonacciSeq, fibonacciConvert))
+		must.Eq(t, collectInts(celiter.Take(a, 3)), []int{0, 1, 1})
+		must.Eq(t, collectInts(celiter.Take(b, 5)), []int{0, 1, 1, 2, 3})
+		must.Eq(t, collectInts(celiter.Take(a, 2)), []int{2, 3})
+	})
+
+	t.Run("has next error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+		a, b := celiter.Tee(celiter.New(
+			func() (bool, error) {
+				return false, errSentinel
+			},
+			func() (int, error) {
+				return 0, nil
+			},
+			fibonacciConvert,
+		))
+		must.True(t, types.IsError(a.HasNext()))
+		must.True(t, types.IsError(b.HasNext()))
+	})
+}
+
+func TestReverse(t *testing.T) {
+	t.Run("collect", func(t *testing.T) {
+		val, err := celiter.Reverse(celiter.FromSeq(slices.Values([]string{"a", "b", "c"}), nil))
+		must.NoError(t, err)
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), []string{"c", "b", "a"})
+	})
+
+	t.Run("index and size", func(t *testing.T) {
+		val, err := celiter.Reverse(celiter.FromSeq(slices.Values([]string{"a", "b", "c"}), nil))
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, val.Get(types.Int(0)), types.String("c"))
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		_, err := celiter.Reverse(celiter.FromSeq(fibonacciSeq, fibonacciConvert, celiter.WithSizeLimit(100)))
+		must.ErrorContains(t, err, "size exceeded maximum of 100")
+	})
+}
+
+func TestBatch(t *testing.T) {
+	collectBatches := func(val ref.Val) [][]int {
+		return slices.Collect(celiter.AsSeq[[]int](val, nil))
+	}
+
+	t.Run("uneven", func(t *testing.T) {
+		val := celiter.Batch(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4, 5}), nil), 2, nil)
+		must.Eq(t, collectBatches(val), [][]int{{1, 2}, {3, 4}, {5}})
+	})
+
+	t.Run("even", func(t *testing.T) {
+		val := celiter.Batch(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4}), nil), 2, nil)
+		must.Eq(t, collectBatches(val), [][]int{{1, 2}, {3, 4}})
+	})
+
+	t.Run("infinite sequence", func(t *testing.T) {
+		val := celiter.Take(celiter.Batch(celiter.FromSeq(fibonacciSeq, nil), 3, nil), 2)
+		must.Eq(t, collectBatches(val), [][]int{{0, 1, 1}, {2, 3, 5}})
+	})
+
+	t.Run("size expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Function(
+				"batches",
+				cel.Overload(
+					"test_batches",
+					[]*cel.Type{},
+					celiter.Type,
+					decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+						return celiter.Batch(celiter.FromSeq(slices.Values([]int{1, 2, 3, 4, 5}), nil), 2, nil)
+					}),
+				),
+			),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("batches().all(b, size(b) <= 2)")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+	})
+}
+
+func TestSorted(t *testing.T) {
+	less := func(a, b int) bool {
+		return a < b
+	}
+
+	t.Run("ascending", func(t *testing.T) {
+		val, err := celiter.Sorted(celiter.FromSeq(slices.Values([]int{3, 1, 2}), fibonacciConvert), less)
+		must.NoError(t, err)
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.Eq(t, collectInts(val), []int{1, 2, 3})
+	})
+
+	t.Run("stable", func(t *testing.T) {
+		val, err := celiter.Sorted(celiter.FromSeq(slices.Values([]string{"bb", "a", "cc", "b"}), nil), func(a, b string) bool {
+			return len(a) < len(b)
+		})
+		must.NoError(t, err)
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), []string{"a", "b", "bb", "cc"})
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		_, err := celiter.Sorted(celiter.FromSeq(fibonacciSeq, fibonacciConvert, celiter.WithSizeLimit(100)), less)
+		must.ErrorContains(t, err, "size exceeded maximum of 100")
+	})
+}
@@ -0,0 +1,48 @@
+package celiter
+
+import (
+	"errors"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Err is the error returned when checking for or getting the next element of
+// an iterable fails, wrapping the original error from the underlying source.
+//
+// CEL only recognizes its own error values, so iterable values return an Err
+// wrapped in a CEL error value, which can be unwrapped with AsError, or with
+// errors.As on the error returned when evaluating a program.
+type Err struct {
+	// Op describes the operation that failed, like "getting next element".
+	Op string
+	// Err is the original error.
+	Err error
+}
+
+// Error returns the error message, like "error getting next element: EOF".
+func (e *Err) Error() string {
+	return "error " + e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the original error.
+func (e *Err) Unwrap() error {
+	return e.Err
+}
+
+// AsError returns the Go error wrapped by a CEL error value, and whether val
+// is a CEL error, so host code can inspect the cause of a failure, like with
+// errors.Is or errors.As. If the CEL error doesn't wrap another error, it is
+// returned itself.
+func AsError(val ref.Val) (error, bool) {
+	celErr, ok := val.(*types.Err)
+	if !ok {
+		return nil, false
+	}
+
+	if err := errors.Unwrap(celErr); err != nil {
+		return err, true
+	}
+
+	return celErr, true
+}
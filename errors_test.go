@@ -0,0 +1,96 @@
+package celiter_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+func TestAsError(t *testing.T) {
+	errSentinel := errors.New("sentinel")
+
+	newValues := func() *celiter.Value[string] {
+		return celiter.New(
+			func() (bool, error) {
+				return true, nil
+			},
+			func() (string, error) {
+				return "", errSentinel
+			},
+			nil,
+		)
+	}
+
+	t.Run("next error", func(t *testing.T) {
+		err, ok := celiter.AsError(newValues().Next())
+		must.True(t, ok)
+		must.ErrorIs(t, err, errSentinel)
+
+		var iterErr *celiter.Err
+		must.True(t, errors.As(err, &iterErr))
+		must.Eq(t, iterErr.Op, "getting next element")
+		must.Eq(t, iterErr.Error(), "error getting next element: sentinel")
+	})
+
+	t.Run("get error", func(t *testing.T) {
+		err, ok := celiter.AsError(newValues().Get(types.Int(0)))
+		must.True(t, ok)
+		must.ErrorIs(t, err, errSentinel)
+	})
+
+	t.Run("has next error", func(t *testing.T) {
+		val := celiter.New[string](
+			func() (bool, error) {
+				return false, errSentinel
+			},
+			nil,
+			nil,
+		)
+
+		err, ok := celiter.AsError(val.HasNext())
+		must.True(t, ok)
+		must.ErrorIs(t, err, errSentinel)
+
+		var iterErr *celiter.Err
+		must.True(t, errors.As(err, &iterErr))
+		must.Eq(t, iterErr.Op, "checking for next element")
+	})
+
+	t.Run("not an error", func(t *testing.T) {
+		err, ok := celiter.AsError(types.String("test"))
+		must.False(t, ok)
+		must.NoError(t, err)
+	})
+
+	t.Run("expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+				return newValues()
+			}),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("values()[0] == 'test'")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		_, _, err = prg.Eval(map[string]any{})
+
+		var iterErr *celiter.Err
+		must.True(t, errors.As(err, &iterErr))
+		must.ErrorIs(t, iterErr, errSentinel)
+	})
+}
@@ -5,6 +5,7 @@ go 1.23.1
 require (
 	github.com/google/cel-go v0.21.0
 	github.com/shoenig/test v1.11.0
+	google.golang.org/protobuf v1.33.0
 )
 
 require (
@@ -14,5 +15,4 @@ require (
 	golang.org/x/exp v0.0.0-20230515195305-f3d0a9c9a5cc // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20230803162519-f966b187b2e5 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20230803162519-f966b187b2e5 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
 )
@@ -0,0 +1,258 @@
+package celiter
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/parser"
+)
+
+// Library returns a cel.EnvOption which installs functions for working with
+// iterable values in CEL expressions:
+//
+//	<iterable>.take(<int>) -> <iterable>
+//	<iterable>.skip(<int>) -> <iterable>
+//	<iterable>.first() -> <dyn>
+//	<iterable>.last() -> <dyn>
+//	<iterable>.count() -> <int>
+//	<iterable>.sizeWhere(<var>, <predicate>) -> <int>
+//
+// Like the combinators they are based on, take and skip are lazy, so they can
+// be used with infinite iterables, like "fibonacci().take(5).size() == 5".
+// The functions also accept any other iterable CEL value, like lists.
+//
+// The sizeWhere macro counts the elements satisfying the predicate in a
+// single pass, like "values().sizeWhere(x, x.startsWith('s')) == 1", without
+// building a filtered list first.
+func Library() cel.EnvOption {
+	return cel.Lib(library{})
+}
+
+// FunctionOption returns a cel.EnvOption which declares a global function
+// returning an iterable value, like "values()", which is shorter than
+// declaring it with cel.Function. The function takes arguments of the given
+// types, if any, which are passed to fn.
+func FunctionOption[T any](name string, fn func(args ...ref.Val) *Value[T], argTypes ...*cel.Type) cel.EnvOption {
+	overloadID := name
+	for _, argType := range argTypes {
+		overloadID += "_" + argType.String()
+	}
+
+	return cel.Function(name,
+		cel.Overload(overloadID, argTypes, Type,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				return fn(args...)
+			}),
+		),
+	)
+}
+
+// VariableOption returns a cel.EnvOption which declares a variable holding an
+// iterable value, so it can be passed through the activation when evaluating
+// a program, like "map[string]any{"xs": values}", instead of being returned
+// by a function.
+//
+// Besides iterable Value instances, the variable can hold a Go sequence, like
+// an iter.Seq[string], which is converted to an iterable value with the
+// environment's type adapter for its elements.
+func VariableOption(name string) cel.EnvOption {
+	return func(e *cel.Env) (*cel.Env, error) {
+		if _, ok := e.CELTypeAdapter().(seqAdapter); !ok {
+			var err error
+			e, err = cel.CustomTypeAdapter(seqAdapter{e.CELTypeAdapter()})(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return cel.Variable(name, Type)(e)
+	}
+}
+
+// seqAdapter is a types.Adapter which converts Go sequences to iterable
+// values, and everything else with the adapter it wraps, see VariableOption.
+type seqAdapter struct {
+	types.Adapter
+}
+
+// NativeToValue converts value to a CEL value.
+func (a seqAdapter) NativeToValue(value any) ref.Val {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || !isSeq(rv.Type()) || rv.IsNil() {
+		return a.Adapter.NativeToValue(value)
+	}
+
+	yieldType := rv.Type().In(0)
+	seq := func(yield func(any) bool) {
+		rv.Call([]reflect.Value{
+			reflect.MakeFunc(yieldType, func(args []reflect.Value) []reflect.Value {
+				return []reflect.Value{reflect.ValueOf(yield(args[0].Interface()))}
+			}),
+		})
+	}
+
+	return FromSeq(seq, nil, WithAdapter(a.Adapter))
+}
+
+// isSeq reports whether typ has the shape of an iter.Seq, which is a function
+// taking a yield function with one argument and returning a bool.
+func isSeq(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Func || typ.NumIn() != 1 || typ.NumOut() != 0 {
+		return false
+	}
+
+	yield := typ.In(0)
+	return yield.Kind() == reflect.Func && yield.NumIn() == 1 && yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+}
+
+// library implements the cel.SingletonLibrary interface.
+type library struct{}
+
+// LibraryName returns the name of the library, so it is only installed once.
+func (library) LibraryName() string {
+	return "celiter"
+}
+
+// CompileOptions returns the function and macro declarations of the library.
+func (library) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Macros(cel.ReceiverMacro("sizeWhere", 2, sizeWhere)),
+		cel.Function("take",
+			cel.MemberOverload("celiter_take_int", []*cel.Type{Type, cel.IntType}, Type,
+				cel.BinaryBinding(func(val, n ref.Val) ref.Val {
+					return withIterable(val, func(v *Value[ref.Val]) ref.Val {
+						return Take(v, int(n.(types.Int)))
+					})
+				}),
+			),
+		),
+		cel.Function("skip",
+			cel.MemberOverload("celiter_skip_int", []*cel.Type{Type, cel.IntType}, Type,
+				cel.BinaryBinding(func(val, n ref.Val) ref.Val {
+					return withIterable(val, func(v *Value[ref.Val]) ref.Val {
+						return Skip(v, int(n.(types.Int)))
+					})
+				}),
+			),
+		),
+		cel.Function("first",
+			cel.MemberOverload("celiter_first", []*cel.Type{Type}, cel.DynType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					return withIterable(val, func(v *Value[ref.Val]) ref.Val {
+						first, ok := First(v)
+						if !ok && first == nil {
+							return types.NewErr("unable to get first element: iterable is empty")
+						}
+						return first
+					})
+				}),
+			),
+		),
+		cel.Function("last",
+			cel.MemberOverload("celiter_last", []*cel.Type{Type}, cel.DynType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					return withIterable(val, func(v *Value[ref.Val]) ref.Val {
+						last, ok := Last(v)
+						if !ok && last == nil {
+							return types.NewErr("unable to get last element: iterable is empty")
+						}
+						return last
+					})
+				}),
+			),
+		),
+		cel.Function("count",
+			cel.MemberOverload("celiter_count", []*cel.Type{Type}, cel.IntType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					return withIterable(val, func(v *Value[ref.Val]) ref.Val {
+						return v.Size()
+					})
+				}),
+			),
+		),
+	}
+}
+
+// sizeWhere expands "<iterable>.sizeWhere(<var>, <predicate>)" into a
+// comprehension which adds one to the result for each element satisfying the
+// predicate.
+func sizeWhere(eh cel.MacroExprFactory, target ast.Expr, args []ast.Expr) (ast.Expr, *common.Error) {
+	if args[0].Kind() != ast.IdentKind {
+		return nil, eh.NewError(args[0].ID(), "argument must be a simple name")
+	}
+
+	step := eh.NewCall(operators.Conditional, args[1],
+		eh.NewCall(operators.Add, eh.NewAccuIdent(), eh.NewLiteral(types.Int(1))),
+		eh.NewAccuIdent(),
+	)
+
+	return eh.NewComprehension(target, args[0].AsIdent(), parser.AccumulatorName,
+		eh.NewLiteral(types.Int(0)), eh.NewLiteral(types.True), step, eh.NewAccuIdent()), nil
+}
+
+// ProgramOptions returns the program options of the library, of which there
+// are none.
+func (library) ProgramOptions() []cel.ProgramOption {
+	return nil
+}
+
+// withIterable calls f with an iterable Value over the elements of val, or
+// returns an error if val isn't iterable.
+func withIterable(val ref.Val, f func(*Value[ref.Val]) ref.Val) ref.Val {
+	v, err := fromIterable(val)
+	if err != nil {
+		return types.WrapErr(err)
+	}
+
+	return f(v)
+}
+
+// fromIterable creates an iterable Value over the elements of any iterable
+// CEL value, so functions can work with values of any element type. If val
+// can be reset or closed, like another iterable Value, so can the result.
+func fromIterable(val ref.Val) (*Value[ref.Val], error) {
+	iterable, ok := val.(traits.Iterable)
+	if !ok {
+		return nil, fmt.Errorf("unable to iterate over %s", val.Type().TypeName())
+	}
+	it := iterable.Iterator()
+
+	hasNext := func() (bool, error) {
+		hasNext := it.HasNext()
+		if err, ok := hasNext.(*types.Err); ok {
+			return false, err
+		}
+		return hasNext == types.True, nil
+	}
+
+	next := func() (ref.Val, error) {
+		next := it.Next()
+		if err, ok := next.(*types.Err); ok {
+			return nil, err
+		}
+		return next, nil
+	}
+
+	var opts []Option
+	if r, ok := val.(interface{ Reset() error }); ok {
+		opts = append(opts, WithRestart(func() error {
+			if err := r.Reset(); err != nil {
+				return err
+			}
+			it = iterable.Iterator()
+			return nil
+		}))
+	}
+	if c, ok := val.(interface{ Close() error }); ok {
+		opts = append(opts, WithClose(c.Close))
+	}
+
+	return New(hasNext, next, func(v ref.Val) ref.Val { return v }, opts...), nil
+}
@@ -0,0 +1,293 @@
+package celiter_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+func TestLibrary(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "take size expression",
+			expr: "fibonacci().take(5).size() == 5",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "skip first expression",
+			expr: "fibonacci().skip(5).first() == 5",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "take last expression",
+			expr: "fibonacci().take(10).last() == 34",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "skip take count expression",
+			expr: "fibonacci().skip(2).take(3).count() == 3",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "take exists expression",
+			expr: "fibonacci().take(5).exists(x, x == 3)",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "take size where expression",
+			expr: "fibonacci().take(10).sizeWhere(x, x % 2 == 0) == 4",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list expression",
+			expr: "[1, 2, 3].skip(1).first() == 2",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "empty first expression",
+			expr: "fibonacci().take(0).first()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "iterable is empty")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				celiter.Library(),
+				cel.Function(
+					"fibonacci",
+					cel.Overload(
+						"fibonacci_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromSeq(fibonacciSeq, func(v int) ref.Val {
+								return types.Int(v)
+							})
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestFunctionOption(t *testing.T) {
+	env, err := cel.NewEnv(
+		celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+			return celiter.FromSlice([]string{"test", "example", "sample"}, nil)
+		}),
+		celiter.FunctionOption("upTo", func(args ...ref.Val) *celiter.Value[int] {
+			return celiter.Take(celiter.FromSeq(fibonacciSeq, nil), int(args[0].(types.Int)))
+		}, cel.IntType),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile("values().exists(x, x == 'example') && size(upTo(5)) == 5")
+	if issues != nil {
+		t.Fatalf("failed to compile CEL expression: %v", issues)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	val, _, err := prg.Eval(map[string]any{})
+	must.NoError(t, err)
+	must.Eq(t, fmt.Sprintf("%v", val), "true")
+}
+
+func TestSizeWhere(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "starts with expression",
+			expr: "values().sizeWhere(x, x.startsWith('s')) == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "no matches expression",
+			expr: "values().sizeWhere(x, x == 'other') == 0",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list expression",
+			expr: "[1, 2, 3].sizeWhere(x, x > 1) == 2",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				celiter.Library(),
+				celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+					return celiter.FromSlice([]string{"test", "example", "sample"}, nil)
+				}),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("invalid variable", func(t *testing.T) {
+		env, err := cel.NewEnv(celiter.Library())
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		_, issues := env.Compile("[1, 2, 3].sizeWhere(x.y, true)")
+		must.NotNil(t, issues)
+		must.StrContains(t, issues.String(), "argument must be a simple name")
+	})
+}
+
+func TestVariableOption(t *testing.T) {
+	tests := []struct {
+		name  string
+		xs    any
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "iterable value",
+			xs:   celiter.FromSlice([]string{"test", "example", "sample"}, nil),
+			expr: "xs.exists(x, x == 'example') && size(xs) == 3",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "sequence",
+			xs:   slices.Values([]string{"test", "example", "sample"}),
+			expr: "xs.exists(x, x == 'example')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "infinite sequence",
+			xs:   fibonacciSeq,
+			expr: "xs.take(10).last() == 34",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list",
+			xs:   []string{"test", "example", "sample"},
+			expr: "xs.skip(1).first() == 'example'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				celiter.Library(),
+				celiter.VariableOption("xs"),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{"xs": test.xs})
+			test.check(t, val, err)
+		})
+	}
+}
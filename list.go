@@ -0,0 +1,224 @@
+package celiter
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// Ensure the List type implements the traits.Lister interface.
+var _ traits.Lister = (*List[any])(nil)
+
+// List is a buffered view of an iterable Value that behaves like a CEL list,
+// allowing it to be indexed in any order, sized, and added to other lists.
+//
+// Elements are only pulled from the underlying iterable as they are needed,
+// and are kept so they can be accessed again. Operations that need every
+// element, like Size, Add, or Equal, drain the underlying iterable, so they
+// should not be used with infinite sources.
+type List[T any] struct {
+	src   *Value[T]
+	elems []ref.Val
+	done  bool
+}
+
+// List returns a buffered view of the iterable value which implements the
+// traits.Lister interface. Use this instead of the value itself when a CEL
+// function should return a list.
+//
+// The Value type doesn't implement traits.Lister itself, because CEL checks
+// the size of a list before indexing it, which would drain the iterable.
+func (v *Value[T]) List() *List[T] {
+	return &List[T]{src: v}
+}
+
+// fill buffers elements from the underlying iterable until at least n of
+// them are available or it is exhausted. A negative n buffers every element.
+func (l *List[T]) fill(n int) ref.Val {
+	for !l.done && (n < 0 || len(l.elems) < n) {
+		hasNext := l.src.HasNext()
+		if types.IsError(hasNext) {
+			return hasNext
+		}
+		if hasNext != types.True {
+			l.done = true
+			break
+		}
+		next := l.src.Next()
+		if types.IsError(next) {
+			return next
+		}
+		l.elems = append(l.elems, next)
+	}
+
+	return nil
+}
+
+// list buffers every element and returns them as a CEL list.
+func (l *List[T]) list() ref.Val {
+	if errVal := l.fill(-1); errVal != nil {
+		return errVal
+	}
+
+	return types.NewRefValList(l.src.adapter, l.elems)
+}
+
+// Add concatenates the list with another list, returning a new CEL list.
+func (l *List[T]) Add(other ref.Val) ref.Val {
+	list := l.list()
+	if types.IsError(list) {
+		return list
+	}
+
+	return list.(traits.Adder).Add(other)
+}
+
+// Contains checks if the list contains the given value, only pulling
+// elements from the underlying iterable until a match is found.
+func (l *List[T]) Contains(val ref.Val) ref.Val {
+	for i := 0; ; i++ {
+		if errVal := l.fill(i + 1); errVal != nil {
+			return errVal
+		}
+		if i >= len(l.elems) {
+			return types.False
+		}
+		if types.Equal(l.elems[i], val) == types.True {
+			return types.True
+		}
+	}
+}
+
+// ConvertToNative converts the list to a native Go type, like a slice.
+func (l *List[T]) ConvertToNative(typ reflect.Type) (any, error) {
+	list := l.list()
+	if err, ok := list.(*types.Err); ok {
+		return nil, err
+	}
+
+	return list.ConvertToNative(typ)
+}
+
+// ConvertToType converts the list to a ref.Val type.
+func (l *List[T]) ConvertToType(typ ref.Type) ref.Val {
+	switch typ {
+	case types.ListType:
+		return l
+	case types.TypeType:
+		return types.ListType
+	}
+
+	return types.NewErr("unable to convert %s to type %s", types.ListType.TypeName(), typ.TypeName())
+}
+
+// Equal checks if the list is equal to another ref.Val type.
+func (l *List[T]) Equal(other ref.Val) ref.Val {
+	list := l.list()
+	if types.IsError(list) {
+		return list
+	}
+
+	return list.Equal(other)
+}
+
+// Get retrieves the element at the given index, which may be before
+// elements that were already accessed.
+func (l *List[T]) Get(index ref.Val) ref.Val {
+	i, err := types.IndexOrError(index)
+	if err != nil {
+		return types.WrapErr(err)
+	}
+	if i < 0 {
+		return types.NewErr("index cannot be negative")
+	}
+
+	if errVal := l.fill(i + 1); errVal != nil {
+		return errVal
+	}
+	if i >= len(l.elems) {
+		return types.NewErr("index out of bounds during list access")
+	}
+
+	return l.elems[i]
+}
+
+// Iterator returns a new iterator over the list, starting from the first
+// element.
+func (l *List[T]) Iterator() traits.Iterator {
+	return &listIterator[T]{list: l}
+}
+
+// Size returns the number of elements in the list.
+func (l *List[T]) Size() ref.Val {
+	if errVal := l.fill(-1); errVal != nil {
+		return errVal
+	}
+
+	return types.Int(len(l.elems))
+}
+
+// Type returns the CEL list type.
+func (l *List[T]) Type() ref.Type {
+	return types.ListType
+}
+
+// Value returns the elements of the list as a []ref.Val.
+func (l *List[T]) Value() any {
+	l.fill(-1)
+	return l.elems
+}
+
+// listIterator iterates over a List, pulling elements on demand.
+type listIterator[T any] struct {
+	list  *List[T]
+	index int
+}
+
+// ConvertToNative is not supported for list iterators.
+func (it *listIterator[T]) ConvertToNative(typ reflect.Type) (any, error) {
+	return nil, fmt.Errorf("type conversion on iterators not supported")
+}
+
+// ConvertToType is not supported for list iterators.
+func (it *listIterator[T]) ConvertToType(typ ref.Type) ref.Val {
+	return types.NewErr("no such overload")
+}
+
+// Equal is not supported for list iterators.
+func (it *listIterator[T]) Equal(other ref.Val) ref.Val {
+	return types.NewErr("no such overload")
+}
+
+// Type returns the CEL iterator type.
+func (it *listIterator[T]) Type() ref.Type {
+	return types.IteratorType
+}
+
+// Value returns nil, as list iterators have no native value.
+func (it *listIterator[T]) Value() any {
+	return nil
+}
+
+// HasNext checks if there is a next element in the list.
+func (it *listIterator[T]) HasNext() ref.Val {
+	if errVal := it.list.fill(it.index + 1); errVal != nil {
+		return errVal
+	}
+
+	return types.Bool(it.index < len(it.list.elems))
+}
+
+// Next retrieves the next element in the list.
+func (it *listIterator[T]) Next() ref.Val {
+	if it.index >= len(it.list.elems) {
+		return types.NewErr("no next element")
+	}
+
+	elem := it.list.elems[it.index]
+	it.index++
+
+	return elem
+}
@@ -0,0 +1,170 @@
+package celiter_test
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "map expression",
+			expr: "values().map(x, x + '!') == ['test!', 'example!', 'sample!']",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "filter expression",
+			expr: "values().filter(x, x.endsWith('ple')) == ['example', 'sample']",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list map expression",
+			expr: "list().map(x, x + '!') == ['test!', 'example!', 'sample!']",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list filter expression",
+			expr: "size(list().filter(x, x.startsWith('t'))) == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list index expression",
+			expr: "list()[2] == 'sample' && list()[0] == 'test'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list invalid index expression",
+			expr: "list()[4] == 'test'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.Error(t, err)
+			},
+		},
+		{
+			name: "list size expression",
+			expr: "size(list()) == 3",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list add expression",
+			expr: "list() + ['extra'] == ['test', 'example', 'sample', 'extra']",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list equality expression",
+			expr: "['test', 'example', 'sample'] == list()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "list in expression",
+			expr: "'example' in list()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := func() *celiter.Value[string] {
+				return celiter.FromSeq(
+					slices.Values([]string{"test", "example", "sample"}),
+					func(v string) ref.Val {
+						return types.String(v)
+					},
+				)
+			}
+
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return values()
+						}),
+					),
+				),
+				cel.Function(
+					"list",
+					cel.Overload(
+						"test_list",
+						[]*cel.Type{},
+						cel.ListType(cel.StringType),
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return values().List()
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("out of order access", func(t *testing.T) {
+		list := celiter.FromSeq(slices.Values([]string{"test", "example", "sample"}), nil).List()
+
+		must.Eq[ref.Val](t, list.Get(types.Int(2)), types.String("sample"))
+		must.Eq[ref.Val](t, list.Get(types.Int(0)), types.String("test"))
+		must.Eq[ref.Val](t, list.Size(), types.Int(3))
+		must.Eq[ref.Val](t, list.Get(types.Int(1)), types.String("example"))
+
+		native, err := list.ConvertToNative(reflect.TypeOf([]string{}))
+		must.NoError(t, err)
+		must.Eq(t, native.([]string), []string{"test", "example", "sample"})
+	})
+}
@@ -0,0 +1,244 @@
+package celiter
+
+import (
+	"bufio"
+	"context"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Option configures optional behavior of an iterable Value.
+type Option func(*options)
+
+// options holds the optional configuration applied by New.
+type options struct {
+	restart       func() error
+	close         func() error
+	ctx           context.Context
+	sizeLimit     int
+	cache         bool
+	negativeIndex bool
+	adapter       types.Adapter
+	splitFunc     bufio.SplitFunc
+	mutex         bool
+	noRecover     bool
+	containsEqual func(cur, target ref.Val) bool
+	onNext        func(index int, val ref.Val)
+	onError       func(error)
+	rateLimit     time.Duration
+	prefetch      int
+	resetOnIter   bool
+	intOverflow   bool
+	logger        func(format string, args ...any)
+}
+
+// applyOptions returns the configuration for the given options, with
+// defaults for anything left unset.
+func applyOptions(opts ...Option) options {
+	o := options{
+		adapter: types.DefaultTypeAdapter,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRestart sets the function used by Reset to restart the underlying
+// source from its first element. Without it, Reset returns an error.
+func WithRestart(restart func() error) Option {
+	return func(o *options) {
+		o.restart = restart
+	}
+}
+
+// WithClose sets the function used by Close to release any resources held
+// by the underlying source, like a cursor or a connection.
+func WithClose(close func() error) Option {
+	return func(o *options) {
+		o.close = close
+	}
+}
+
+// WithSizeLimit sets the maximum number of elements Size will count before
+// giving up and returning an error, which prevents it from hanging on
+// infinite sources. A limit of zero or less means unbounded, the default.
+//
+// Contains is capped the same way, so checking for an element which isn't
+// in an infinite source, like "'missing' in values()", returns an error once
+// the limit is reached instead of searching forever.
+func WithSizeLimit(n int) Option {
+	return func(o *options) {
+		o.sizeLimit = n
+	}
+}
+
+// WithContext sets a context which is checked before advancing the iterable.
+// Once the context is done, HasNext and Next return a CEL error wrapping the
+// context's error, which stops evaluation of slow or unbounded sources.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithCache keeps every element yielded by the iterable, so Get can serve
+// indexes before the current position, like in "values()[2] == values()[0]",
+// and Contains gives the same result when called more than once.
+//
+// The cache grows with each element, so it should only be used for sources
+// that are small enough to be held in memory.
+func WithCache() Option {
+	return func(o *options) {
+		o.cache = true
+	}
+}
+
+// WithNegativeIndex allows Get to resolve negative indexes relative to the
+// end of the iterable, so "values()[-1]" is the last element. It implies
+// WithCache, since the remaining elements have to be drained and kept to find
+// the end.
+//
+// Negative indexes never resolve on infinite sources, unless a limit is set
+// with WithSizeLimit, in which case an error is returned once it is exceeded.
+func WithNegativeIndex() Option {
+	return func(o *options) {
+		o.negativeIndex = true
+	}
+}
+
+// WithAdapter sets the type adapter used to convert elements to CEL values
+// when New is given a nil convert function, and to build CEL lists from the
+// iterable. Use this with environments that have custom types, like
+// protobuf messages, so elements are converted using the environment's
+// adapter (see cel.Env.CELTypeAdapter).
+//
+// The default is types.DefaultTypeAdapter.
+func WithAdapter(adapter types.Adapter) Option {
+	return func(o *options) {
+		o.adapter = adapter
+	}
+}
+
+// WithSplitFunc sets the function used by FromReader to split its input
+// into elements, like bufio.ScanWords or bufio.ScanRunes. The default is
+// bufio.ScanLines.
+func WithSplitFunc(split bufio.SplitFunc) Option {
+	return func(o *options) {
+		o.splitFunc = split
+	}
+}
+
+// WithMutex guards HasNext, Next, Peek, IsEmpty, Get, Size, and Contains
+// with a mutex, so the iterable value can be shared by CEL evaluations running
+// in multiple goroutines. The value is still single-pass: each element is only
+// yielded once, to whichever goroutine advances the iterable first.
+func WithMutex() Option {
+	return func(o *options) {
+		o.mutex = true
+	}
+}
+
+// WithoutRecover disables recovering from panics in the next and convert
+// functions. By default, a panic while getting the next element is returned
+// as a CEL error from Next, instead of crashing the program evaluating the
+// expression. Use this to fail fast, with the original stack trace.
+func WithoutRecover() Option {
+	return func(o *options) {
+		o.noRecover = true
+	}
+}
+
+// WithContainsComparator sets the function used by Contains to check if an
+// element matches the target value, like a case-insensitive string match.
+// The default compares elements using their Equal method.
+func WithContainsComparator(equal func(cur, target ref.Val) bool) Option {
+	return func(o *options) {
+		o.containsEqual = equal
+	}
+}
+
+// WithOnNext sets a function which is called with the index and value of
+// every element yielded by the iterable, including those consumed by Get,
+// Size, or Contains. Use this to observe how many elements an expression
+// actually consumed, like for metrics.
+func WithOnNext(onNext func(index int, val ref.Val)) Option {
+	return func(o *options) {
+		o.onNext = onNext
+	}
+}
+
+// WithOnError sets a function which is called with any error checking for
+// or getting the next element of the iterable, before it is returned as a
+// CEL error.
+func WithOnError(onError func(error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
+
+// WithRateLimit makes the iterable wait until at least interval has passed
+// since the previous element was fetched before fetching the next one, which
+// is useful for sources backed by rate-limited APIs. The wait happens once per
+// element, when checking for it with HasNext, since many sources, like
+// FromSeq, read the element then, or when getting it with Next otherwise.
+//
+// If a context is set with WithContext, the wait is abandoned once it is
+// done, and a CEL error wrapping the context's error is returned.
+func WithRateLimit(interval time.Duration) Option {
+	return func(o *options) {
+		o.rateLimit = interval
+	}
+}
+
+// WithPrefetch fetches up to n elements ahead of the iterable on a background
+// goroutine, so slow sources, like ones backed by network calls, are fetched
+// while the expression is evaluated. Elements are still yielded in order.
+//
+// The goroutine is started when the iterable is first advanced, and stopped
+// by Close or Reset, so values using this option should always be closed.
+func WithPrefetch(n int) Option {
+	return func(o *options) {
+		o.prefetch = n
+	}
+}
+
+// WithResetOnIterate resets the iterable each time it is iterated by a macro,
+// like "exists" or "all", if it was already advanced, so every macro sees all
+// of its elements. This is useful when the same value is referenced more than
+// once in an expression, like "values().exists(x, x == 'a') &&
+// values().all(x, size(x) > 0)".
+//
+// The source must be restartable (see WithRestart). Macros nested over the
+// same value still share its position, since resetting for the inner macro
+// would restart the outer one, so use WithCache for those instead.
+func WithResetOnIterate() Option {
+	return func(o *options) {
+		o.resetOnIter = true
+	}
+}
+
+// WithIntOverflowCheck makes the iterable return a CEL error for elements
+// which are unsigned integers too large for a CEL int, instead of the wrapped
+// negative number, when they are converted to one, like by a convert function
+// returning types.Int(v).
+//
+// Only the conversion is checked, so elements which already overflowed in Go,
+// like a Fibonacci number computed with int arithmetic, aren't detected.
+func WithIntOverflowCheck() Option {
+	return func(o *options) {
+		o.intOverflow = true
+	}
+}
+
+// WithLogger sets a function which logs each call to HasNext, Next, and Get,
+// with its result and the position of the iterable, like log.Printf or
+// testing.T.Logf. This helps to diagnose how an expression consumes the
+// iterable, like why an exists macro returns an unexpected result.
+func WithLogger(logf func(format string, args ...any)) Option {
+	return func(o *options) {
+		o.logger = logf
+	}
+}
@@ -0,0 +1,42 @@
+package celiter
+
+import (
+	"sync"
+)
+
+// Pool reuses iterable Value instances, to reduce allocations when many
+// short-lived values are created, like one per request. The zero value is
+// ready to use, and a Pool is safe for concurrent use.
+type Pool[T any] struct {
+	pool sync.Pool
+}
+
+// Acquire returns an iterable Value instance from the pool, set up like New
+// with the given arguments, or a new one if the pool is empty.
+func (p *Pool[T]) Acquire(hasNext HasNext, next Next[T], convert Convert[T], opts ...Option) *Value[T] {
+	v, ok := p.pool.Get().(*Value[T])
+	if !ok {
+		v = &Value[T]{}
+	}
+
+	v.init(hasNext, next, convert, opts...)
+
+	return v
+}
+
+// Release closes v, clears its state, and returns it to the pool, so a later
+// Acquire can reuse it. The error from closing v, if any, is returned, but v
+// is returned to the pool regardless.
+//
+// A released value must not be used afterward, including by combinators
+// sharing its position, or values acquired later may be corrupted.
+func (p *Pool[T]) Release(v *Value[T]) error {
+	err := v.Close()
+
+	clear(v.cached)
+	*v = Value[T]{cached: v.cached[:0], index: -1}
+
+	p.pool.Put(v)
+
+	return err
+}
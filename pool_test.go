@@ -0,0 +1,83 @@
+package celiter_test
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+// counter returns functions yielding the numbers from 0 up to n.
+func counter(n int) (celiter.HasNext, celiter.Next[int]) {
+	var i int
+
+	hasNext := func() (bool, error) {
+		return i < n, nil
+	}
+
+	next := func() (int, error) {
+		i++
+		return i - 1, nil
+	}
+
+	return hasNext, next
+}
+
+func TestPool(t *testing.T) {
+	var pool celiter.Pool[int]
+
+	t.Run("acquire", func(t *testing.T) {
+		hasNext, next := counter(3)
+		val := pool.Acquire(hasNext, next, nil)
+		must.Eq(t, collectInts(val), []int{0, 1, 2})
+		must.NoError(t, pool.Release(val))
+	})
+
+	t.Run("reacquired clean state", func(t *testing.T) {
+		var closed bool
+
+		hasNext, next := counter(3)
+		val := pool.Acquire(hasNext, next, nil, celiter.WithCache(), celiter.WithSizeLimit(2), celiter.WithClose(func() error {
+			closed = true
+			return nil
+		}))
+		must.Eq[ref.Val](t, val.Get(types.Int(1)), types.Int(1))
+		must.NoError(t, pool.Release(val))
+		must.True(t, closed)
+
+		hasNext, next = counter(5)
+		val = pool.Acquire(hasNext, next, nil)
+		must.Eq(t, val.Index(), -1)
+		must.Nil(t, val.Value())
+
+		must.Eq[ref.Val](t, val.Get(types.Int(1)), types.Int(1))
+		must.True(t, types.IsError(val.Get(types.Int(0))))
+		must.Eq[ref.Val](t, val.Size(), types.Int(5))
+		must.NoError(t, pool.Release(val))
+	})
+}
+
+func BenchmarkPool(b *testing.B) {
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			hasNext, next := counter(10)
+			val := celiter.New(hasNext, next, nil, celiter.WithCache())
+			val.Size()
+		}
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		var pool celiter.Pool[int]
+
+		b.ReportAllocs()
+		for range b.N {
+			hasNext, next := counter(10)
+			val := pool.Acquire(hasNext, next, nil, celiter.WithCache())
+			val.Size()
+			_ = pool.Release(val)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package celiter
+
+import (
+	"context"
+)
+
+// prefetched is an element fetched ahead by a prefetching source, or the
+// error checking for or getting it.
+type prefetched[T any] struct {
+	val      T
+	err      error
+	checkErr bool
+}
+
+// prefetch wraps the functions of a source so up to n elements are fetched
+// ahead on a background goroutine, see WithPrefetch.
+//
+// The goroutine is started the first time the next element is checked for,
+// and stopped by the returned restart and close functions before they call
+// the given ones, so the source is never used by two goroutines at once.
+func prefetch[T any](n int, ctx context.Context, hasNext HasNext, next Next[T], restart, closeFn func() error) (HasNext, Next[T], func() error, func() error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var (
+		ch   chan prefetched[T]
+		stop chan struct{}
+		done chan struct{}
+		cur  prefetched[T]
+	)
+
+	start := func() {
+		ch = make(chan prefetched[T], n)
+		stop = make(chan struct{})
+		done = make(chan struct{})
+
+		go func(ch chan<- prefetched[T], stop <-chan struct{}, done chan<- struct{}) {
+			defer close(done)
+			defer close(ch)
+
+			send := func(p prefetched[T]) bool {
+				select {
+				case ch <- p:
+					return true
+				case <-stop:
+					return false
+				}
+			}
+
+			for {
+				ok, err := hasNext()
+				if err != nil {
+					send(prefetched[T]{err: err, checkErr: true})
+					return
+				}
+				if !ok {
+					return
+				}
+				val, err := next()
+				if !send(prefetched[T]{val: val, err: err}) || err != nil {
+					return
+				}
+			}
+		}(ch, stop, done)
+	}
+
+	halt := func() {
+		if stop == nil {
+			return
+		}
+		close(stop)
+		<-done
+		ch, stop, done = nil, nil, nil
+	}
+
+	prefetchHasNext := func() (bool, error) {
+		if ch == nil {
+			start()
+		}
+		select {
+		case p, ok := <-ch:
+			if !ok {
+				return false, nil
+			}
+			if p.checkErr {
+				return false, p.err
+			}
+			cur = p
+			return true, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	prefetchNext := func() (T, error) {
+		p := cur
+		cur = prefetched[T]{}
+		return p.val, p.err
+	}
+
+	var prefetchRestart func() error
+	if restart != nil {
+		prefetchRestart = func() error {
+			halt()
+			return restart()
+		}
+	}
+
+	prefetchClose := func() error {
+		halt()
+		if closeFn != nil {
+			return closeFn()
+		}
+		return nil
+	}
+
+	return prefetchHasNext, prefetchNext, prefetchRestart, prefetchClose
+}
@@ -0,0 +1,86 @@
+package celiter_test
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+func TestPrefetch(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		values := make([]int, 100)
+		for i := range values {
+			values[i] = i
+		}
+
+		val := celiter.FromSeq(slices.Values(values), nil, celiter.WithPrefetch(4))
+		defer val.Close()
+
+		must.Eq(t, collectInts(val), values)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values([]int{1, 2, 3}), nil, celiter.WithPrefetch(2))
+		defer val.Close()
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.Int(1))
+		must.NoError(t, val.Reset())
+		must.Eq(t, collectInts(val), []int{1, 2, 3})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		index := 0
+		val := celiter.New(
+			func() (bool, error) {
+				if index == 2 {
+					return false, errSentinel
+				}
+				return true, nil
+			},
+			func() (int, error) {
+				index++
+				return index, nil
+			},
+			fibonacciConvert,
+			celiter.WithPrefetch(4),
+		)
+		defer val.Close()
+
+		_, err := celiter.AsSlice(val, func(v ref.Val) int {
+			return int(v.(types.Int))
+		})
+		must.ErrorIs(t, err, errSentinel)
+	})
+
+	t.Run("close stops fetching", func(t *testing.T) {
+		var fetched atomic.Int64
+
+		val := celiter.New(
+			func() (bool, error) {
+				return true, nil
+			},
+			func() (int, error) {
+				return int(fetched.Add(1)), nil
+			},
+			fibonacciConvert,
+			celiter.WithPrefetch(2),
+		)
+
+		must.Eq(t, collectInts(celiter.Take(val, 3)), []int{1, 2, 3})
+		must.NoError(t, val.Close())
+
+		n := fetched.Load()
+		time.Sleep(10 * time.Millisecond)
+		must.Eq(t, n, fetched.Load())
+	})
+}
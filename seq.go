@@ -0,0 +1,52 @@
+package celiter
+
+import (
+	"iter"
+)
+
+// MapSeq returns a sequence which lazily applies f to each element of seq.
+// Like the other sequence helpers, it mirrors the combinator of the same
+// name, but works on Go sequences, so they can be composed before being
+// passed to FromSeq.
+func MapSeq[T, U any](seq iter.Seq[T], f func(T) U) iter.Seq[U] {
+	return func(yield func(U) bool) {
+		for t := range seq {
+			if !yield(f(t)) {
+				return
+			}
+		}
+	}
+}
+
+// FilterSeq returns a sequence which only yields the elements of seq that
+// satisfy pred.
+func FilterSeq[T any](seq iter.Seq[T], pred func(T) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for t := range seq {
+			if pred(t) && !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// TakeSeq returns a sequence which yields at most the first n elements of
+// seq, so it can be used to bound infinite sequences. The elements after
+// them are never pulled from seq.
+func TakeSeq[T any](seq iter.Seq[T], n int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if n <= 0 {
+			return
+		}
+		var taken int
+		for t := range seq {
+			if !yield(t) {
+				return
+			}
+			taken++
+			if taken >= n {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package celiter_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+)
+
+func TestMapSeq(t *testing.T) {
+	seq := celiter.MapSeq(slices.Values([]string{"test", "example"}), strings.ToUpper)
+	must.Eq(t, slices.Collect(seq), []string{"TEST", "EXAMPLE"})
+}
+
+func TestFilterSeq(t *testing.T) {
+	seq := celiter.FilterSeq(slices.Values([]int{1, 2, 3, 4}), func(v int) bool {
+		return v%2 == 0
+	})
+	must.Eq(t, slices.Collect(seq), []int{2, 4})
+}
+
+func TestTakeSeq(t *testing.T) {
+	t.Run("infinite sequence", func(t *testing.T) {
+		must.Eq(t, slices.Collect(celiter.TakeSeq(fibonacciSeq, 5)), []int{0, 1, 1, 2, 3})
+	})
+
+	t.Run("shorter sequence", func(t *testing.T) {
+		must.Eq(t, slices.Collect(celiter.TakeSeq(slices.Values([]int{1, 2}), 5)), []int{1, 2})
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		var pulled bool
+		seq := celiter.TakeSeq(func(yield func(int) bool) {
+			pulled = true
+			yield(1)
+		}, 0)
+		must.SliceEmpty(t, slices.Collect(seq))
+		must.False(t, pulled)
+	})
+}
+
+func TestSeqComposition(t *testing.T) {
+	even := func(v int) bool {
+		return v%2 == 0
+	}
+	label := func(v int) string {
+		return fmt.Sprintf("fib-%d", v)
+	}
+
+	env, err := cel.NewEnv(
+		celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+			return celiter.FromSeq(celiter.MapSeq(celiter.TakeSeq(celiter.FilterSeq(fibonacciSeq, even), 4), label), nil)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile("size(values()) == 4 && values().exists(x, x == 'fib-34')")
+	if issues != nil {
+		t.Fatalf("failed to compile CEL expression: %v", issues)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	val, _, err := prg.Eval(map[string]any{})
+	must.NoError(t, err)
+	must.Eq(t, fmt.Sprintf("%v", val), "true")
+}
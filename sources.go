@@ -0,0 +1,362 @@
+package celiter
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Empty creates a new iterable Value instance without any elements, like
+// for a function which has nothing to return. Size returns zero, Contains
+// returns false, and Get returns an error for any index.
+func Empty[T any](opts ...Option) *Value[T] {
+	return fromIndex(func() int {
+		return 0
+	}, func(int) T {
+		var zero T
+		return zero
+	}, nil, opts...)
+}
+
+// Repeat creates a new iterable Value instance which yields v n times, or
+// forever if n is negative, which is useful for tests and synthetic data.
+//
+// With a negative n, Size never returns, unless a limit is set with
+// WithSizeLimit, so the value should be bounded first, like with Take.
+func Repeat[T any](v T, n int, convert Convert[T], opts ...Option) *Value[T] {
+	if n >= 0 {
+		return fromIndex(func() int {
+			return n
+		}, func(int) T {
+			return v
+		}, convert, opts...)
+	}
+
+	hasNext := func() (bool, error) {
+		return true, nil
+	}
+
+	next := func() (T, error) {
+		return v, nil
+	}
+
+	restart := func() error {
+		return nil
+	}
+
+	return New(hasNext, next, convert, append([]Option{WithRestart(restart)}, opts...)...)
+}
+
+// Range creates a new iterable Value instance which yields the numbers from
+// start up to, but not including, stop, increasing by step, like
+// Range(0, 5, 1) yields 0, 1, 2, 3, and 4. With a negative step, the numbers
+// decrease down to stop instead, like Range(5, 0, -1) yields 5, 4, 3, 2, and
+// 1. If stop can't be reached from start in the direction of step, or step is
+// zero, no numbers are yielded.
+//
+// Numbers are computed from their index, so Size, Get, and Contains don't
+// advance the value.
+func Range(start, stop, step int64, convert Convert[int64], opts ...Option) *Value[int64] {
+	var n uint64
+	switch {
+	case step > 0 && start < stop:
+		n = rangeLen(uint64(stop-start), uint64(step))
+	case step < 0 && start > stop:
+		n = rangeLen(uint64(start-stop), -uint64(step))
+	}
+	length := int(min(n, math.MaxInt))
+
+	return fromIndex(func() int {
+		return length
+	}, func(i int) int64 {
+		return start + int64(i)*step
+	}, convert, opts...)
+}
+
+// rangeLen returns the number of steps of size step needed to cover a
+// distance of diff, counting a partial step as one.
+func rangeLen(diff, step uint64) uint64 {
+	n := diff / step
+	if diff%step != 0 {
+		n++
+	}
+	return n
+}
+
+// FromSlice creates a new iterable Value instance which yields the elements
+// of a slice. Unlike FromSeq, elements are accessed by index, so Size and
+// Contains don't advance the value, and Iterator returns a new iterator over
+// every element, so macros can be nested over the same value.
+func FromSlice[T any](s []T, convert Convert[T], opts ...Option) *Value[T] {
+	return fromIndex(func() int {
+		return len(s)
+	}, func(i int) T {
+		return s[i]
+	}, convert, opts...)
+}
+
+// FromProtoList creates a new iterable Value instance over the elements of
+// a protobuf list, like a repeated field, without copying them. Elements are
+// accessed by index, so Get can access them in any order, and Size and
+// Contains don't advance the value.
+//
+// If convert is nil, elements are converted with the type adapter (see
+// WithAdapter), after unwrapping messages to their proto.Message.
+func FromProtoList(list protoreflect.List, convert Convert[protoreflect.Value], opts ...Option) *Value[protoreflect.Value] {
+	if convert == nil {
+		adapter := applyOptions(opts...).adapter
+		convert = func(v protoreflect.Value) ref.Val {
+			switch v := v.Interface().(type) {
+			case protoreflect.Message:
+				return adapter.NativeToValue(v.Interface())
+			case protoreflect.EnumNumber:
+				return types.Int(v)
+			default:
+				return adapter.NativeToValue(v)
+			}
+		}
+	}
+
+	return fromIndex(list.Len, list.Get, convert, opts...)
+}
+
+// FromSQLRows creates a new iterable Value instance which yields the rows
+// of a database query, like to filter them with an expression. Each row is
+// read with scan, which should call rows.Scan.
+//
+// The rows are closed once they are exhausted, or when Close is called, and
+// any error from rows.Err is returned as a CEL error when checking for the
+// next element.
+func FromSQLRows[T any](rows *sql.Rows, scan func(*sql.Rows) (T, error), convert Convert[T], opts ...Option) *Value[T] {
+	hasNext := func() (bool, error) {
+		if rows.Next() {
+			return true, nil
+		}
+		err := rows.Err()
+		if closeErr := rows.Close(); err == nil {
+			err = closeErr
+		}
+		return false, err
+	}
+
+	next := func() (T, error) {
+		return scan(rows)
+	}
+
+	return New(hasNext, next, convert, append([]Option{WithClose(rows.Close)}, opts...)...)
+}
+
+// FromJSONArray creates a new iterable Value instance which streams the
+// elements of a JSON array from a decoder, without reading the whole array
+// into memory. The opening bracket is read the first time the value is
+// advanced, and an error is returned if the input isn't an array or an
+// element is malformed.
+//
+// If convert is nil, each element is decoded into a Go value, like a
+// map[string]any for objects, and converted with the type adapter (see
+// WithAdapter).
+func FromJSONArray(dec *json.Decoder, convert Convert[json.RawMessage], opts ...Option) *Value[json.RawMessage] {
+	if convert == nil {
+		adapter := applyOptions(opts...).adapter
+		convert = func(raw json.RawMessage) ref.Val {
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return types.WrapErr(err)
+			}
+			return adapter.NativeToValue(v)
+		}
+	}
+
+	var started, done bool
+
+	hasNext := func() (bool, error) {
+		if done {
+			return false, nil
+		}
+		if !started {
+			tok, err := dec.Token()
+			if err != nil {
+				return false, fmt.Errorf("error reading JSON array: %w", err)
+			}
+			if tok != json.Delim('[') {
+				return false, fmt.Errorf("error reading JSON array: unexpected token %v", tok)
+			}
+			started = true
+		}
+		if dec.More() {
+			return true, nil
+		}
+		if _, err := dec.Token(); err != nil {
+			return false, fmt.Errorf("error reading JSON array: %w", err)
+		}
+		done = true
+		return false, nil
+	}
+
+	next := func() (json.RawMessage, error) {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("error reading JSON array element: %w", err)
+		}
+		return raw, nil
+	}
+
+	return New(hasNext, next, convert, opts...)
+}
+
+// FromChannel creates a new iterable Value instance which receives its
+// elements from a channel, until the channel is closed.
+//
+// Checking for the next element blocks until a value is received. If a
+// context is given with WithContext, a blocked receive is abandoned once the
+// context is done, and a CEL error is returned instead.
+func FromChannel[T any](ch <-chan T, convert Convert[T], opts ...Option) *Value[T] {
+	ctx := applyOptions(opts...).ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var cur T
+
+	hasNext := func() (bool, error) {
+		select {
+		case val, ok := <-ch:
+			cur = val
+			return ok, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	getNext := func() (T, error) {
+		return cur, nil
+	}
+
+	return New(hasNext, getNext, convert, opts...)
+}
+
+// FromReader creates a new iterable Value instance which yields each line read
+// from r, without the line ending. Use WithSplitFunc to split the input in
+// other ways, like by words or runes.
+//
+// Errors reading from r are returned as CEL errors when checking for the
+// next element.
+func FromReader(r io.Reader, convert Convert[string], opts ...Option) *Value[string] {
+	scanner := bufio.NewScanner(r)
+	if split := applyOptions(opts...).splitFunc; split != nil {
+		scanner.Split(split)
+	}
+
+	hasNext := func() (bool, error) {
+		if scanner.Scan() {
+			return true, nil
+		}
+		return false, scanner.Err()
+	}
+
+	next := func() (string, error) {
+		return scanner.Text(), nil
+	}
+
+	return New(hasNext, next, convert, opts...)
+}
+
+// FromMapKeys creates a new iterable Value instance which yields the keys of
+// m. Like ranging over a map, the order of the keys is not specified and may
+// change between iterations, see FromMapKeysSorted for a stable order. For
+// the same reason, the value can only be cloned if it was created with
+// WithCache (see Clone).
+func FromMapKeys[K comparable, V any](m map[K]V, convert Convert[K], opts ...Option) *Value[K] {
+	v := FromSeq(maps.Keys(m), convert, opts...)
+	// Ranging over m again may yield the keys in a different order.
+	v.clone = nil
+	return v
+}
+
+// FromMapValues creates a new iterable Value instance which yields the values
+// of m. Like ranging over a map, the order of the values is not specified and
+// may change between iterations, see FromMapValuesSorted for a stable order.
+// For the same reason, the value can only be cloned if it was created with
+// WithCache (see Clone).
+func FromMapValues[K comparable, V any](m map[K]V, convert Convert[V], opts ...Option) *Value[V] {
+	v := FromSeq(maps.Values(m), convert, opts...)
+	// Ranging over m again may yield the values in a different order.
+	v.clone = nil
+	return v
+}
+
+// FromMapKeysSorted creates a new iterable Value instance which yields the
+// keys of m in ascending order. The keys are sorted at the start of each
+// iteration pass.
+func FromMapKeysSorted[K cmp.Ordered, V any](m map[K]V, convert Convert[K], opts ...Option) *Value[K] {
+	return FromSeqFunc(func() iter.Seq[K] {
+		return slices.Values(slices.Sorted(maps.Keys(m)))
+	}, convert, opts...)
+}
+
+// FromMapValuesSorted creates a new iterable Value instance which yields the
+// values of m in the ascending order of their keys. The keys are sorted at the
+// start of each iteration pass.
+func FromMapValuesSorted[K cmp.Ordered, V any](m map[K]V, convert Convert[V], opts ...Option) *Value[V] {
+	return FromSeqFunc(func() iter.Seq[V] {
+		return func(yield func(V) bool) {
+			for _, k := range slices.Sorted(maps.Keys(m)) {
+				if !yield(m[k]) {
+					return
+				}
+			}
+		}
+	}, convert, opts...)
+}
+
+// FromMap creates a new iterable Value instance which yields the values of m
+// in the ascending order of their keys, and which can be indexed by key, like
+// "m['key']", as well as by position, like "m[0]".
+//
+// A key is looked up in m if it can be converted to K, so for maps with
+// integer keys, an int index is always treated as a key rather than a
+// position. Looking up a missing key returns an error. Like a list, Contains
+// checks the values of m, not its keys.
+//
+// The keys are sorted when the value is created, so m should not be modified
+// afterward.
+func FromMap[K cmp.Ordered, V any](m map[K]V, convert Convert[V], opts ...Option) *Value[V] {
+	keys := slices.Sorted(maps.Keys(m))
+	keyType := reflect.TypeFor[K]()
+
+	v := fromIndex(func() int {
+		return len(keys)
+	}, func(i int) V {
+		return m[keys[i]]
+	}, convert, opts...)
+
+	v.lookup = func(key ref.Val, convert Convert[V]) ref.Val {
+		native, err := key.ConvertToNative(keyType)
+		if err != nil {
+			return nil
+		}
+		val, ok := m[native.(K)]
+		if !ok {
+			return types.NewErr("no such key: %v", key)
+		}
+		return convert(val)
+	}
+	v.clone = func() *Value[V] {
+		return FromMap(m, convert, opts...)
+	}
+
+	return v
+}
@@ -0,0 +1,897 @@
+package celiter_test
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/celiter"
+	"github.com/shoenig/test/must"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFromChannel(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "true exists expression",
+			expr: "values().exists(x, x == 'example')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "false exists expression",
+			expr: "values().exists(x, x == 'notfound')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name: "true index expression",
+			expr: "values()[0] == 'test'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "invalid index expression",
+			expr: "values()[4] == 'test'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.Error(t, err)
+			},
+		},
+		{
+			name: "true in expression",
+			expr: "'sample' in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "false in expression",
+			expr: "'blah' in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							ch := make(chan string, 3)
+							ch <- "test"
+							ch <- "example"
+							ch <- "sample"
+							close(ch)
+
+							return celiter.FromChannel(ch, func(v string) ref.Val {
+								return types.String(v)
+							})
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("cancelled receive", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		ch := make(chan string, 1)
+		ch <- "test"
+
+		val := celiter.FromChannel(ch, nil, celiter.WithContext(ctx))
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("test"))
+
+		err, ok := val.HasNext().(*types.Err)
+		must.True(t, ok)
+		must.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestFromReader(t *testing.T) {
+	const logs = "INFO starting server\nWARN slow request\nERROR connection reset\nINFO shutting down\n"
+
+	tests := []struct {
+		name  string
+		expr  string
+		opts  []celiter.Option
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "true exists expression",
+			expr: "lines().exists(x, x.startsWith('ERROR'))",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "false exists expression",
+			expr: "lines().exists(x, x.startsWith('DEBUG'))",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name: "index expression",
+			expr: "lines()[1] == 'WARN slow request'",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "size expression",
+			expr: "size(lines()) == 4",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "words size expression",
+			expr: "size(lines()) == 12",
+			opts: []celiter.Option{celiter.WithSplitFunc(bufio.ScanWords)},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"lines",
+					cel.Overload(
+						"test_lines",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromReader(strings.NewReader(logs), nil, test.opts...)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+
+	t.Run("read error", func(t *testing.T) {
+		errSentinel := errors.New("sentinel")
+
+		val := celiter.FromReader(io.MultiReader(strings.NewReader("first\n"), iotest.ErrReader(errSentinel)), nil)
+
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("first"))
+
+		err, ok := val.HasNext().(*types.Err)
+		must.True(t, ok)
+		must.ErrorIs(t, err, errSentinel)
+	})
+}
+
+func TestFromMap(t *testing.T) {
+	m := map[string]string{
+		"a": "test",
+		"b": "example",
+		"c": "sample",
+	}
+
+	tests := []struct {
+		name   string
+		expr   string
+		values func() ref.Val
+		check  func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "keys exists expression",
+			expr: "values().exists(x, x == 'b')",
+			values: func() ref.Val {
+				return celiter.FromMapKeys(m, nil)
+			},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "values exists expression",
+			expr: "values().exists(x, x == 'sample')",
+			values: func() ref.Val {
+				return celiter.FromMapValues(m, nil)
+			},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "values false exists expression",
+			expr: "values().exists(x, x == 'a')",
+			values: func() ref.Val {
+				return celiter.FromMapValues(m, nil)
+			},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name: "sorted keys index expression",
+			expr: "values()[0] == 'a' && values()[2] == 'c'",
+			values: func() ref.Val {
+				return celiter.FromMapKeysSorted(m, nil)
+			},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "sorted values index expression",
+			expr: "values()[1] == 'example'",
+			values: func() ref.Val {
+				return celiter.FromMapValuesSorted(m, nil)
+			},
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return test.values()
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	t.Run("has next", func(t *testing.T) {
+		val := celiter.Empty[string]()
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+		must.Eq[ref.Val](t, val.HasNext(), types.False)
+	})
+
+	t.Run("size", func(t *testing.T) {
+		must.Eq[ref.Val](t, celiter.Empty[string]().Size(), types.Int(0))
+	})
+
+	t.Run("contains", func(t *testing.T) {
+		must.Eq[ref.Val](t, celiter.Empty[string]().Contains(types.String("")), types.False)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		val := celiter.Empty[string]().Get(types.Int(0))
+		must.True(t, types.IsError(val))
+		must.StrContains(t, fmt.Sprintf("%v", val), "index out of bounds")
+	})
+
+	t.Run("expression", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[string] {
+				return celiter.Empty[string]()
+			}),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, issues := env.Compile("size(values()) == 0 && !('test' in values()) && !values().exists(x, true)")
+		if issues != nil {
+			t.Fatalf("failed to compile CEL expression: %v", issues)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		val, _, err := prg.Eval(map[string]any{})
+		must.NoError(t, err)
+		must.Eq(t, fmt.Sprintf("%v", val), "true")
+	})
+}
+
+func TestRepeat(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		val := celiter.Repeat("x", 3, nil)
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), []string{"x", "x", "x"})
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		must.Eq[ref.Val](t, celiter.Repeat("x", 0, nil).Size(), types.Int(0))
+	})
+
+	t.Run("infinite", func(t *testing.T) {
+		val := celiter.Take(celiter.Repeat("x", -1, nil), 5)
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), []string{"x", "x", "x", "x", "x"})
+	})
+
+	t.Run("infinite size limit", func(t *testing.T) {
+		val := celiter.Repeat("x", -1, nil, celiter.WithSizeLimit(10))
+		must.True(t, types.IsError(val.Size()))
+	})
+}
+
+func TestRange(t *testing.T) {
+	collect := func(val *celiter.Value[int64]) []int64 {
+		return slices.Collect(celiter.AsSeq[int64](val, nil))
+	}
+
+	t.Run("ascending", func(t *testing.T) {
+		val := celiter.Range(0, 5, 1, nil)
+		must.Eq[ref.Val](t, val.Size(), types.Int(5))
+		must.Eq(t, collect(val), []int64{0, 1, 2, 3, 4})
+	})
+
+	t.Run("descending", func(t *testing.T) {
+		must.Eq(t, collect(celiter.Range(5, 0, -1, nil)), []int64{5, 4, 3, 2, 1})
+	})
+
+	t.Run("partial step", func(t *testing.T) {
+		must.Eq(t, collect(celiter.Range(0, 10, 3, nil)), []int64{0, 3, 6, 9})
+		must.Eq(t, collect(celiter.Range(10, 0, -4, nil)), []int64{10, 6, 2})
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		must.Eq[ref.Val](t, celiter.Range(0, 0, 1, nil).Size(), types.Int(0))
+		must.Eq[ref.Val](t, celiter.Range(5, 0, 1, nil).Size(), types.Int(0))
+		must.Eq[ref.Val](t, celiter.Range(0, 5, -1, nil).Size(), types.Int(0))
+		must.Eq[ref.Val](t, celiter.Range(0, 5, 0, nil).Size(), types.Int(0))
+	})
+
+	t.Run("full range", func(t *testing.T) {
+		val := celiter.Range(math.MinInt64, math.MaxInt64, math.MaxInt64, nil)
+		must.Eq(t, collect(val), []int64{math.MinInt64, -1, math.MaxInt64 - 1})
+	})
+
+	t.Run("get and contains", func(t *testing.T) {
+		val := celiter.Range(0, 100, 5, nil)
+		must.Eq[ref.Val](t, val.Get(types.Int(3)), types.Int(15))
+		must.Eq[ref.Val](t, val.Contains(types.Int(95)), types.True)
+		must.Eq[ref.Val](t, val.Contains(types.Int(96)), types.False)
+	})
+}
+
+func TestFromSlice(t *testing.T) {
+	values := []string{"test", "example", "sample"}
+
+	t.Run("size without advancing", func(t *testing.T) {
+		val := celiter.FromSlice(values, nil)
+
+		size, ok := val.SizeHint()
+		must.True(t, ok)
+		must.Eq(t, size, 3)
+
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+		must.Eq(t, slices.Collect(celiter.AsSeq[string](val, nil)), values)
+	})
+
+	t.Run("size after next", func(t *testing.T) {
+		val := celiter.FromSlice(values, nil)
+		must.Eq[ref.Val](t, val.HasNext(), types.True)
+		must.Eq[ref.Val](t, val.Next(), types.String("test"))
+		must.Eq[ref.Val](t, val.Size(), types.Int(3))
+
+		size, ok := val.SizeHint()
+		must.True(t, ok)
+		must.Eq(t, size, 2)
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		val := celiter.FromSlice(values, nil, celiter.WithSizeLimit(2))
+		must.True(t, types.IsError(val.Size()))
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		val := celiter.FromSeq(slices.Values(values), nil)
+
+		size, ok := val.SizeHint()
+		must.False(t, ok)
+		must.Eq(t, size, 0)
+	})
+}
+
+func TestFromProtoList(t *testing.T) {
+	list, err := structpb.NewList([]any{"test", 1.5, true})
+	must.NoError(t, err)
+
+	fd := list.ProtoReflect().Descriptor().Fields().ByName("values")
+
+	newValues := func() *celiter.Value[protoreflect.Value] {
+		return celiter.FromProtoList(list.ProtoReflect().Get(fd).List(), nil)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "size expression",
+			expr: "size(values()) == 3",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "out of order index expression",
+			expr: "values()[2] == true && values()[0] == 'test' && values()[1] == 1.5",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "size and index expression",
+			expr: "size(values()) == 3 && values()[0] == 'test' && 'test' in values()",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "invalid index expression",
+			expr: "values()[3]",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "index out of bounds")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := newValues()
+
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return values
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+// errFakeRows is returned by fakeRows after its rows for the "fail" query.
+var errFakeRows = errors.New("connection lost")
+
+// fakeDriver is a database/sql driver which returns a fixed set of names for
+// any query, or fails after the first name for the "fail" query.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{query: query}, nil
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (fakeStmt) Close() error {
+	return nil
+}
+
+func (fakeStmt) NumInput() int {
+	return 0
+}
+
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.query == "fail" {
+		return &fakeRows{names: []string{"test"}, err: errFakeRows}, nil
+	}
+	return &fakeRows{names: []string{"test", "example", "sample"}, err: io.EOF}, nil
+}
+
+type fakeRows struct {
+	names []string
+	err   error
+}
+
+func (*fakeRows) Columns() []string {
+	return []string{"name"}
+}
+
+func (*fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.names) == 0 {
+		return r.err
+	}
+	dest[0], r.names = r.names[0], r.names[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("celiter_fake", fakeDriver{})
+}
+
+func TestFromSQLRows(t *testing.T) {
+	db, err := sql.Open("celiter_fake", "")
+	must.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	scanName := func(rows *sql.Rows) (string, error) {
+		var name string
+		err := rows.Scan(&name)
+		return name, err
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name:  "true exists expression",
+			query: "names",
+			expr:  "rows().exists(x, x == 'sample')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name:  "false exists expression",
+			query: "names",
+			expr:  "rows().exists(x, x == 'notfound')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "false")
+			},
+		},
+		{
+			name:  "rows error expression",
+			query: "fail",
+			expr:  "size(rows()) == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorIs(t, err, errFakeRows)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := db.Query(test.query)
+			must.NoError(t, err)
+
+			values := celiter.FromSQLRows(rows, scanName, func(name string) ref.Val {
+				return types.String(name)
+			})
+			defer values.Close()
+
+			env, err := cel.NewEnv(
+				cel.Function(
+					"rows",
+					cel.Overload(
+						"test_rows",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return values
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestFromJSONArray(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name:  "size expression",
+			input: `[{"name": "test"}, {"name": "example"}, {"name": "sample"}]`,
+			expr:  "size(values()) == 3",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name:  "exists expression",
+			input: `[{"name": "test"}, {"name": "example"}, {"name": "sample"}]`,
+			expr:  "values().exists(x, x.name == 'example')",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name:  "empty array expression",
+			input: `[]`,
+			expr:  "size(values()) == 0",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name:  "not an array expression",
+			input: `{"name": "test"}`,
+			expr:  "size(values()) == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "unexpected token")
+			},
+		},
+		{
+			name:  "malformed element expression",
+			input: `[{"name": "test"}, {"name": }]`,
+			expr:  "size(values()) == 2",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "error reading JSON array element")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := cel.NewEnv(
+				cel.Function(
+					"values",
+					cel.Overload(
+						"test_values",
+						[]*cel.Type{},
+						celiter.Type,
+						decls.FunctionBinding(func(_ ...ref.Val) ref.Val {
+							return celiter.FromJSONArray(json.NewDecoder(strings.NewReader(test.input)), nil)
+						}),
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}
+
+func TestFromMapIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		check func(t *testing.T, val ref.Val, err error)
+	}{
+		{
+			name: "key index expression",
+			expr: "values()['example'] == 2 && values()['test'] == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "position index expression",
+			expr: "values()[0] == 2 && values()[2] == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+		{
+			name: "missing key expression",
+			expr: "values()['other'] == 1",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.ErrorContains(t, err, "no such key")
+			},
+		},
+		{
+			name: "values expression",
+			expr: "size(values()) == 3 && 3 in values() && values().all(x, x > 0)",
+			check: func(t *testing.T, val ref.Val, err error) {
+				must.NoError(t, err)
+				must.Eq(t, fmt.Sprintf("%v", val), "true")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := celiter.FromMap(map[string]int{"test": 1, "example": 2, "sample": 3}, nil)
+
+			env, err := cel.NewEnv(
+				celiter.FunctionOption("values", func(_ ...ref.Val) *celiter.Value[int] {
+					return values
+				}),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, issues := env.Compile(test.expr)
+			if issues != nil {
+				t.Fatalf("failed to compile CEL expression: %v", issues)
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			val, _, err := prg.Eval(map[string]any{})
+			test.check(t, val, err)
+		})
+	}
+}